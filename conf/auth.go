@@ -0,0 +1,257 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pmalmgren/godot/term"
+	sshagent "github.com/xanzy/ssh-agent"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// sshConfig reads ~/.ssh/config and /etc/ssh/ssh_config
+var sshConfig interface {
+	Get(alias, key string) string
+} = ssh_config.DefaultUserSettings
+
+// defaultKeys are the private keys tried when ssh_config names none that exists
+var defaultKeys = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// tokenVariables are the environment variables holding access tokens for a host,
+// GODOT_GIT_TOKEN is used for the host named in GODOT_GIT_TOKEN_HOST
+var tokenVariables = map[string][]string{
+	"github.com": {"GITHUB_TOKEN", "GH_TOKEN"},
+	"gitlab.com": {"GITLAB_TOKEN"},
+}
+
+// askPassphrase asks for the passphrase of an encrypted private key
+var askPassphrase = func(keyFile string) ([]byte, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("%s is encrypted and there's no terminal to ask for its passphrase, add it to ssh-agent instead", keyFile)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", keyFile)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// authMethod returns the credentials to clone u with, or nil when none are needed
+// or known. SSH remotes use the SSH agent or a private key and verify the host
+// against known_hosts, HTTPS remotes use a token from the environment or ~/.netrc.
+// Plain HTTP remotes only get the credentials written in their URL.
+func authMethod(u *url.URL) (transport.AuthMethod, error) {
+	switch u.Scheme {
+	case "ssh", "git+ssh":
+		return sshAuth(u)
+	case "http", "https":
+		return httpAuth(u)
+	}
+	return nil, nil
+}
+
+func sshAuth(u *url.URL) (transport.AuthMethod, error) {
+	host := u.Hostname()
+	user := u.User.Username()
+	if user == "" {
+		user = sshConfig.Get(host, "User")
+	}
+	if user == "" {
+		user = "git"
+	}
+	hostKeys, err := hostKeyCallback(host)
+	if err != nil {
+		return nil, err
+	}
+	helper := gitssh.HostKeyCallbackHelper{HostKeyCallback: hostKeys}
+
+	if sshagent.Available() {
+		agent, _, err := sshagent.New()
+		if err == nil {
+			if keys, err := agent.List(); err == nil && len(keys) > 0 {
+				return &gitssh.PublicKeysCallback{User: user, Callback: agent.Signers, HostKeyCallbackHelper: helper}, nil
+			}
+		}
+	}
+
+	signer, err := keyFileSigner(host)
+	if err != nil {
+		return nil, err
+	}
+	return &gitssh.PublicKeys{User: user, Signer: signer, HostKeyCallbackHelper: helper}, nil
+}
+
+// hostKeyCallback verifies host keys against the known_hosts files of ssh_config,
+// or SSH_KNOWN_HOSTS when it is set. Verification is only skipped when
+// StrictHostKeyChecking is no.
+func hostKeyCallback(host string) (ssh.HostKeyCallback, error) {
+	if strings.ToLower(sshConfig.Get(host, "StrictHostKeyChecking")) == "no" {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	var files []string
+	if os.Getenv("SSH_KNOWN_HOSTS") == "" {
+		for _, file := range strings.Fields(sshConfig.Get(host, "UserKnownHostsFile")) {
+			if expanded, err := homedir.Expand(file); err == nil {
+				files = append(files, expanded)
+			}
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+	}
+	callback, err := gitssh.NewKnownHostsCallback(files...)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading known_hosts: %v", err)
+	}
+	return callback, nil
+}
+
+// keyFileSigner loads the private key for host: GODOT_SSH_KEY, the IdentityFile of
+// ssh_config or a default key. The passphrase of an encrypted key is asked for.
+func keyFileSigner(host string) (ssh.Signer, error) {
+	candidates := defaultKeys
+	if key := os.Getenv("GODOT_SSH_KEY"); key != "" {
+		candidates = []string{key}
+	} else if identity := sshConfig.Get(host, "IdentityFile"); identity != "" {
+		candidates = append([]string{identity}, defaultKeys...)
+	}
+
+	for _, candidate := range candidates {
+		keyFile, err := homedir.Expand(candidate)
+		if err != nil {
+			return nil, err
+		}
+		pemBytes, err := ioutil.ReadFile(keyFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %v", keyFile, err)
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err == nil {
+			return signer, nil
+		}
+		if !strings.Contains(err.Error(), "encrypted") {
+			return nil, fmt.Errorf("Error parsing %s: %v", keyFile, err)
+		}
+		passphrase, err := askPassphrase(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting %s: %v", keyFile, err)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("No SSH agent and no private key found for %s, tried %s", host, strings.Join(candidates, ", "))
+}
+
+func httpAuth(u *url.URL) (transport.AuthMethod, error) {
+	host := u.Hostname()
+	if password, ok := u.User.Password(); ok {
+		return &githttp.BasicAuth{Username: u.User.Username(), Password: password}, nil
+	}
+	if u.Scheme != "https" {
+		return nil, nil
+	}
+	names := tokenVariables[host]
+	if strings.EqualFold(os.Getenv("GODOT_GIT_TOKEN_HOST"), host) {
+		names = append([]string{"GODOT_GIT_TOKEN"}, names...)
+	}
+	for _, name := range names {
+		if token := os.Getenv(name); token != "" {
+			return &githttp.BasicAuth{Username: tokenUser(host), Password: token}, nil
+		}
+	}
+	login, password, err := netrcCredentials(host)
+	if err != nil || login == "" {
+		return nil, err
+	}
+	return &githttp.BasicAuth{Username: login, Password: password}, nil
+}
+
+// tokenUser is the user name sent along with an access token, GitHub accepts any
+// while GitLab expects oauth2
+func tokenUser(host string) string {
+	if host == "gitlab.com" {
+		return "oauth2"
+	}
+	return "x-access-token"
+}
+
+// netrcCredentials finds the login and password for host in $NETRC or ~/.netrc
+func netrcCredentials(host string) (string, string, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", "", nil
+		}
+		path = filepath.Join(home, name)
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	defer f.Close()
+
+	// entries are `machine <host> login <login> password <password>`, in any
+	// order and over any number of lines, and `default` matches every host
+	sc := bufio.NewScanner(f)
+	sc.Split(bufio.ScanWords)
+	var login, password string
+	matching := false
+	for sc.Scan() {
+		switch sc.Text() {
+		case "machine", "default":
+			if matching {
+				return login, password, nil
+			}
+			matching = true
+			if sc.Text() == "machine" {
+				sc.Scan()
+				matching = sc.Text() == host
+			}
+		case "login":
+			sc.Scan()
+			if matching {
+				login = sc.Text()
+			}
+		case "password":
+			sc.Scan()
+			if matching {
+				password = sc.Text()
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", "", fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	return login, password, nil
+}
@@ -0,0 +1,346 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+// invalidCacheChars are replaced in the names of cached clones
+var invalidCacheChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// inUse holds the cached clones used by this process, flock doesn't keep a process
+// from locking a file twice
+var inUse = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// CachedClone is a clone in the cache directory
+type CachedClone struct {
+	Directory string
+	// Remote is the URL the clone is fetched from
+	Remote string
+	// Used is when the clone was last used
+	Used time.Time
+	// Size is the size of the clone's files in bytes
+	Size int64
+}
+
+// CacheDirectory returns the directory clones are cached in, $XDG_CACHE_HOME/godot/repos
+func CacheDirectory() (string, error) {
+	return reposDirectory("XDG_CACHE_HOME", ".cache")
+}
+
+// DataDirectory returns the directory godot apply keeps clones in, $XDG_DATA_HOME/godot/repos
+func DataDirectory() (string, error) {
+	return reposDirectory("XDG_DATA_HOME", dataHome)
+}
+
+// dataHome is the default of $XDG_DATA_HOME in the home directory
+var dataHome = filepath.Join(".local", "share")
+
+// reposDirectory returns the repos directory in the godot directory of env, see
+// xdgDirectory
+func reposDirectory(env string, fallback string) (string, error) {
+	dir, err := xdgDirectory(env, fallback)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "repos"), nil
+}
+
+// xdgDirectory returns godot in the directory named by the environment variable
+// env, or in fallback in the home directory if it isn't set
+func xdgDirectory(env string, fallback string) (string, error) {
+	base := os.Getenv(env)
+	if base == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", fmt.Errorf("Error finding home directory: %v", err)
+		}
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, "godot"), nil
+}
+
+// CachePath returns the directory of the cached clone of remote, see cloneName
+func CachePath(remote *url.URL) (string, error) {
+	dir, err := CacheDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cloneName(remote)), nil
+}
+
+// cloneName names a clone of remote after the remote without credentials, see dirName
+func cloneName(remote *url.URL) string {
+	return dirName(sourceURL(remote))
+}
+
+// RenderedPath returns the directory godot apply renders the templates of the
+// repository source into, in $XDG_DATA_HOME/godot/rendered
+func RenderedPath(source string) (string, error) {
+	dir, err := xdgDirectory("XDG_DATA_HOME", dataHome)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rendered", dirName(source)), nil
+}
+
+// SecretsPath returns the directory the secrets of the container name are decrypted
+// into while it runs, in $XDG_RUNTIME_DIR/godot/secrets, which is only kept in memory.
+// Without XDG_RUNTIME_DIR it's kept in the temporary directory, which other users
+// can write to, so the directories it's in are checked to be private.
+func SecretsPath(name string) (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		base = filepath.Join(os.TempDir(), fmt.Sprintf("godot-%d", os.Getuid()))
+		if err := privateDirectory(base); err != nil {
+			return "", err
+		}
+	}
+	dir := filepath.Join(base, "godot")
+	if err := privateDirectory(dir); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secrets", name), nil
+}
+
+// privateDirectory creates dir readable only by the user running godot, or checks
+// that an existing dir is: a directory, not a symbolic link, owned by the user and
+// with mode 0700
+func privateDirectory(dir string) error {
+	err := os.Mkdir(dir, 0700)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("Error creating %s: %v", dir, err)
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("Error using %s: not a directory", dir)
+	}
+	if !ownedByUser(fi) {
+		return fmt.Errorf("Error using %s: owned by another user", dir)
+	}
+	if fi.Mode().Perm() != 0700 {
+		return fmt.Errorf("Error using %s: mode %#o, not 0700", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// dirName names a directory after source, and a hash of it so names don't collide
+func dirName(source string) string {
+	readable := source
+	if i := strings.Index(readable, "://"); i >= 0 {
+		readable = readable[i+3:]
+	}
+	readable = strings.Trim(invalidCacheChars.ReplaceAllString(strings.TrimSuffix(readable, ".git"), "-"), "-.")
+	if len(readable) > 64 {
+		readable = readable[len(readable)-64:]
+	}
+	sum := sha256.Sum256([]byte(source))
+	return readable + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// AppliedRepository returns the clone of remote in the data directory with ref
+// checked out, cloning it or fetching the latest changes as described in Pull,
+// which checks signatures with trustedKeys if it's set. Dotfiles applied on the host link into it, so it's kept out of the cache.
+func AppliedRepository(remote *url.URL, ref string, trustedKeys string) (*GitRepository, error) {
+	dir, err := DataDirectory()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating data directory: %v", err)
+	}
+	repo := &GitRepository{Remote: remote, RepoDirectory: filepath.Join(dir, cloneName(remote)), Ref: ref, TrustedKeys: trustedKeys}
+	if err := repo.Pull(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// CachedRepository returns the cached clone of remote with ref checked out, cloning
+// it or fetching the latest changes as described in Pull, which checks signatures
+// with trustedKeys if it's set. The clone is locked so
+// other godot processes wait until release is called. When this process already
+// uses the clone, e.g. for a configuration extending another one in the same
+// repository, a temporary clone is returned instead, so files in use don't change.
+func CachedRepository(remote *url.URL, ref string, trustedKeys string) (repo *GitRepository, release func(), err error) {
+	path, err := CachePath(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	inUse.Lock()
+	used := inUse.paths[path]
+	inUse.paths[path] = true
+	inUse.Unlock()
+	if used {
+		return temporaryRepository(remote, ref, trustedKeys)
+	}
+	done := func() {
+		inUse.Lock()
+		delete(inUse.paths, path)
+		inUse.Unlock()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		done()
+		return nil, nil, fmt.Errorf("Error creating cache directory: %v", err)
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	release = func() {
+		unlock()
+		done()
+	}
+
+	repo = &GitRepository{Remote: remote, RepoDirectory: path, Ref: ref, TrustedKeys: trustedKeys}
+	if err := repo.Pull(); err != nil {
+		release()
+		return nil, nil, err
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return repo, release, nil
+}
+
+// ExistingCachedRepository returns the cached clone of remote as it is, without
+// contacting the remote, and locks it like CachedRepository. With trustedKeys, its
+// HEAD must be signed by one of them, see VerifyDirectory.
+func ExistingCachedRepository(remote *url.URL, trustedKeys string) (repo *GitRepository, release func(), err error) {
+	path, err := CachePath(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, fmt.Errorf("%s isn't cached, clone it with --fetch", sourceURL(remote))
+	}
+	repo = &GitRepository{Remote: remote, RepoDirectory: path, TrustedKeys: trustedKeys}
+	inUse.Lock()
+	used := inUse.paths[path]
+	inUse.paths[path] = true
+	inUse.Unlock()
+	if used {
+		// this process already holds the lock
+		return repo, func() {}, nil
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		inUse.Lock()
+		delete(inUse.paths, path)
+		inUse.Unlock()
+		return nil, nil, err
+	}
+	release = func() {
+		unlock()
+		inUse.Lock()
+		delete(inUse.paths, path)
+		inUse.Unlock()
+	}
+	if trustedKeys != "" {
+		if err := VerifyDirectory(path, trustedKeys); err != nil {
+			release()
+			return nil, nil, err
+		}
+	}
+	return repo, release, nil
+}
+
+// temporaryRepository clones remote into a temporary directory that release removes
+func temporaryRepository(remote *url.URL, ref string, trustedKeys string) (*GitRepository, func(), error) {
+	tmpDir, err := ioutil.TempDir("", "godot-repo")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating temporary directory: %v", err)
+	}
+	release := func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Printf("Error removing temporary Git repo: %v", err)
+		}
+	}
+	repo := &GitRepository{Remote: remote, RepoDirectory: tmpDir, Ref: ref, TrustedKeys: trustedKeys}
+	if err := repo.Pull(); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return repo, release, nil
+}
+
+// CachedClones lists the clones in the cache directory
+func CachedClones() ([]CachedClone, error) {
+	dir, err := CacheDirectory()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading cache directory: %v", err)
+	}
+	var clones []CachedClone
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		clone := CachedClone{Directory: filepath.Join(dir, entry.Name()), Used: entry.ModTime()}
+		if repo, err := git.PlainOpen(clone.Directory); err == nil {
+			if cfg, err := repo.Config(); err == nil {
+				if origin, ok := cfg.Remotes[git.DefaultRemoteName]; ok && len(origin.URLs) > 0 {
+					clone.Remote = origin.URLs[0]
+				}
+			}
+		}
+		filepath.Walk(clone.Directory, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				clone.Size += info.Size()
+			}
+			return nil
+		})
+		clones = append(clones, clone)
+	}
+	return clones, nil
+}
+
+// Remove deletes the cached clone, waiting for godot processes using it
+func (c CachedClone) Remove() error {
+	unlock, err := lockFile(c.Directory + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.RemoveAll(c.Directory); err != nil {
+		return fmt.Errorf("Error removing %s: %v", c.Directory, err)
+	}
+	return nil
+}
@@ -10,102 +10,127 @@
 package conf
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
-	"html/template"
-	"log"
-	"os"
+	"io/ioutil"
+	"runtime"
+	"sort"
 	"strings"
-
-	yaml "gopkg.in/yaml.v2"
 )
 
-func parseReadme(path string) (string, error) {
-	f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+// parseReadme extracts the godot configuration from a README.md. The configuration
+// blocks are joined into one YAML document, and lines maps each of its lines back
+// to the README line it came from. A key set in two blocks is an error, as the last
+// value would silently replace the first.
+func parseReadme(path string) (raw string, lines []int, err error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error opening README.md: %v", err)
+	}
 
+	scan, err := scanReadme(string(contents))
 	if err != nil {
-		return "", fmt.Errorf("Error opening README.md: %v", err)
+		return "", nil, err
 	}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Printf("Error closing README.md: %v", err)
-		}
-	}()
+	if !scan.sawHeader {
+		return "", nil, fmt.Errorf("Your README.md needs a `%s` header", confHeader)
+	}
 
-	sc := bufio.NewScanner(f)
-	var raw string
-	var sawHeader bool
-	var insideConfig bool
-	for sc.Scan() {
-		token := strings.TrimSuffix(sc.Text(), "\n")
+	if len(scan.blocks) == 0 {
+		return "", nil, fmt.Errorf("Your README.md needs a YAML code block with the configuration")
+	}
 
-		if !sawHeader {
-			sawHeader = token == confHeader
-			continue
+	if err := checkBlockKeys(scan.blocks); err != nil {
+		return "", nil, err
+	}
+	for _, block := range scan.blocks {
+		for i, line := range block.lines {
+			raw += line
+			raw += "\n"
+			lines = append(lines, block.lineNumbers[i])
 		}
+	}
+	return raw, lines, nil
+}
 
-		if !insideConfig {
-			insideConfig = token == confBoundaryToken
-			continue
+// checkBlockKeys reports the first top-level key set in more than one block, with
+// the README lines of both
+func checkBlockKeys(blocks []fencedBlock) error {
+	seen := make(map[string]int)
+	for _, block := range blocks {
+		keys, _ := yamlKeyLines(strings.Join(block.lines, "\n"))
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
 		}
-
-		if insideConfig {
-			if token == confBoundaryToken {
-				break
+		sort.Slice(names, func(i, j int) bool { return keys[names[i]] < keys[names[j]] })
+		for _, name := range names {
+			line := block.lineNumbers[keys[name]-1]
+			if first, ok := seen[name]; ok {
+				return fmt.Errorf("%s is set at line %d and again at line %d, set it in one block", name, first, line)
 			}
-			raw += token
-			raw += "\n"
+			seen[name] = line
 		}
 	}
+	return nil
+}
 
-	if !sawHeader {
-		return "", fmt.Errorf("Your README.md needs a `## godot configuration` header")
-	}
-
-	if !insideConfig {
-		return "", fmt.Errorf("Your README.md needs a YAML code block with the configuration")
+// readmeHasConfig reports whether a README.md contains a godot configuration section
+func readmeHasConfig(path string) bool {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
 	}
-
-	return raw, nil
+	scan, err := scanReadme(string(contents))
+	return err != nil || scan.sawHeader
 }
 
 // ConfigFromReadme parses the README.md and reads it into a `GoDotConfig` object.
-func ConfigFromReadme(r *Repository) (*GoDotConfig, error) {
-	readmePath, err := r.GetFilePath("README.md")
-	if err != nil {
-		return nil, fmt.Errorf("README.md does not exist: %v", err)
-	}
+func ConfigFromReadme(r Repository) (*GoDotConfig, error) {
+	return ConfigFromRepository(r, LoadOptions{ConfigName: "README.md"})
+}
 
-	raw, err := parseReadme(readmePath)
+// ConfigFromRepository finds the godot configuration in a repository, resolves what it
+// extends, applies the requested profile and reads it into a `GoDotConfig` object.
+// The caller must close it once it's done with the repository's files.
+func ConfigFromRepository(r Repository, opts LoadOptions) (*GoDotConfig, error) {
+	src, err := FindConfig(r, opts.ConfigName)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid Godot configuration: %v", err)
+		return nil, err
 	}
 
-	var gdc GoDotConfig
-	gdc.RepoDirectory = r.RepoDirectory
-	if err := yaml.Unmarshal([]byte(raw), &gdc); err != nil {
+	var raw GoDotConfig
+	if err := src.Decode(&raw); err != nil {
 		return nil, fmt.Errorf("Error reading repository configuration: %v", err)
 	}
-	gdc.DockerfileRendered, err = BuildDockerfile(&gdc)
+	base, err := raw.Resolve(r, src, opts.TrustedKeys)
 	if err != nil {
-		return nil, fmt.Errorf("Error compiling Dockerfile template: %v", err)
+		return nil, fmt.Errorf("Error resolving extends: %v", err)
 	}
-	return &gdc, nil
-}
-
-// BuildDockerfile applies a GoDotConfig object to the Dockerfile.tmpl file
-func BuildDockerfile(gdc *GoDotConfig) (string, error) {
-	t, err := template.New("Dockerfile").Parse(dockerfileTemplate)
+	base.RepoDirectory = r.Directory()
+	gdc, err := base.WithProfile(opts.Profile)
 	if err != nil {
-		return "", fmt.Errorf("Error parsing template file: %v", err)
+		base.Close()
+		return nil, err
 	}
-	var tpl bytes.Buffer
-	err = t.Execute(&tpl, gdc)
+	gdc.Vars = mergeMaps(gdc.Vars, opts.Vars)
+	gdc.Arch = opts.Arch
+	if gdc.Arch == "" {
+		gdc.Arch = runtime.GOARCH
+	}
+	gdc.DockerfileRendered, err = BuildDockerfile(gdc)
+	if err != nil {
+		gdc.Close()
+		return nil, err
+	}
+	return gdc, nil
+}
 
+// BuildDockerfile renders the Dockerfile for a GoDotConfig object
+func BuildDockerfile(gdc *GoDotConfig) (string, error) {
+	df, err := DockerfileFromConfig(gdc)
 	if err != nil {
-		return "", fmt.Errorf("Error rendering Dockerfile.tmpl: %v", err)
+		return "", fmt.Errorf("Error building Dockerfile: %v", err)
 	}
-	return tpl.String(), nil
+	return df.String(), nil
 }
@@ -14,6 +14,8 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -41,7 +43,7 @@ system-setup:
 # user-setup runs as the user defined above in username.
 user-setup:
   - RUN mkdir user-setup
-  - RUN cd user-setup
+  - workdir: user-setup
 ` + "```"
 
 func TestConfigFromReadme(t *testing.T) {
@@ -58,7 +60,7 @@ func TestConfigFromReadme(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error getting current working directory: %v", err)
 	}
-	r := &Repository{RepoDirectory: dir}
+	r := &FilesystemRepository{RepoDirectory: dir}
 
 	actual, err := ConfigFromReadme(r)
 
@@ -70,16 +72,151 @@ func TestConfigFromReadme(t *testing.T) {
 		Username:           "test-user",
 		DotfileDirectory:   "test-dotfile-directory",
 		Packages:           []string{"neovim", "git"},
-		SystemSetup:        []string{"RUN ls", "RUN touch system-setup"},
-		UserSetup:          []string{"RUN mkdir user-setup", "RUN cd user-setup"},
+		SystemSetup:        RawSteps("RUN ls", "RUN touch system-setup"),
+		UserSetup:          []Step{{Raw: "RUN mkdir user-setup"}, {Workdir: "user-setup"}},
 		EntryPoint:         "test-entrypoint",
 		ImageTag:           "test-dev-env",
+		Arch:               runtime.GOARCH,
 		OutputDirectory:    "",
 		RepoDirectory:      dir,
 		DockerfileRendered: "",
 	}
+	expected.DockerfileRendered, err = BuildDockerfile(expected)
+	if err != nil {
+		t.Fatalf("Error rendering expected Dockerfile: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected != actual.\n%+v\n!=\n%+v", expected, actual)
+	}
+}
+
+// writeRepo creates a temporary repository containing files
+func writeRepo(t *testing.T, files map[string]string) *FilesystemRepository {
+	dir, err := ioutil.TempDir("/tmp", "")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("Error creating directory for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+	return &FilesystemRepository{RepoDirectory: dir}
+}
+
+func removeRepo(t *testing.T, r *FilesystemRepository) {
+	if err := os.RemoveAll(r.RepoDirectory); err != nil {
+		t.Logf("Error removing temporary directory %s: %v", r.RepoDirectory, err)
+	}
+}
+
+func TestConfigFromRepositoryFormats(t *testing.T) {
+	tests := map[string]string{
+		"godot.yaml":  "username: test-user\nimage-tag: test-dev-env\npackages:\n  - git\n",
+		".godot.yml":  "username: test-user\nimage-tag: test-dev-env\npackages: [git]\n",
+		"godot.json":  `{"username": "test-user", "image-tag": "test-dev-env", "packages": ["git"]}`,
+		".godot.toml": "# comment\nusername = \"test-user\"\nimage-tag = 'test-dev-env'\npackages = [\n  \"git\",\n]\n",
+	}
+	for name, contents := range tests {
+		r := writeRepo(t, map[string]string{name: contents})
+		gdc, err := ConfigFromRepository(r, LoadOptions{})
+		removeRepo(t, r)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if gdc.Username != "test-user" || gdc.ImageTag != "test-dev-env" || !reflect.DeepEqual(gdc.Packages, []string{"git"}) {
+			t.Errorf("%s: unexpected configuration: %+v", name, gdc)
+		}
+	}
+}
+
+func TestFindConfigConflict(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "username: yaml-user\n",
+		"README.md":  readme,
+	})
+	defer removeRepo(t, r)
+
+	if _, err := FindConfig(r, ""); err == nil || !strings.Contains(err.Error(), "godot.yaml, README.md") {
+		t.Fatalf("Expected a conflict error, got: %v", err)
+	}
+
+	src, err := FindConfig(r, "godot.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error choosing godot.yaml: %v", err)
+	}
+	if src.Format != FormatYAML || src.Path != "godot.yaml" {
+		t.Errorf("Unexpected source: %+v", src)
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	raw := `title = "a \"quoted\" \u00e9"
+literal = 'C:\path'
+count = 1_000
+ratio = 0.5
+enabled = true
+multi = """
+line one \
+  continued"""
+nested = [[1, 2], ["a"]]
+inline = { name = "x", deep.key = 'y' }
+
+[profiles.work]
+packages = ["git"]
 
+[[steps]]
+run = "make"
+
+[[steps]]
+run = "make install"
+`
+	actual, err := decodeTOML(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"title":   "a \"quoted\" \u00e9",
+		"literal": `C:\path`,
+		"count":   int64(1000),
+		"ratio":   0.5,
+		"enabled": true,
+		"multi":   "line one continued",
+		"nested":  []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a"}},
+		"inline":  map[string]interface{}{"name": "x", "deep": map[string]interface{}{"key": "y"}},
+		"profiles": map[string]interface{}{
+			"work": map[string]interface{}{"packages": []interface{}{"git"}},
+		},
+		"steps": []map[string]interface{}{
+			{"run": "make"},
+			{"run": "make install"},
+		},
+	}
 	if !reflect.DeepEqual(actual, expected) {
 		t.Errorf("Expected != actual.\n%+v\n!=\n%+v", expected, actual)
 	}
+
+	if _, err := decodeTOML("a = 1\na = 2\n"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected duplicate key error on line 2, got: %v", err)
+	}
+	if _, err := decodeTOML("a = 010\n"); err == nil {
+		t.Errorf("Expected an error for an integer with a leading zero")
+	}
+}
+
+func TestDecodeTOMLErrorLines(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.toml": "# godot\nusername = \"test-user\"\nimage-tag = \"test-env\"\n\npackages = \"git\"\n",
+	})
+	defer removeRepo(t, r)
+
+	_, err := ConfigFromRepository(r, LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "godot.toml") || !strings.Contains(err.Error(), "line 5") {
+		t.Fatalf("Expected an error pointing at godot.toml line 5, got: %v", err)
+	}
 }
@@ -0,0 +1,226 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultDistro is used when neither distro nor base-image are configured
+const defaultDistro = "debian"
+
+// PackageManager knows the shell commands that prepare a distribution's base image
+type PackageManager interface {
+	// Name is the package manager's command, e.g. apt-get
+	Name() string
+	// Upgrade refreshes the package index and upgrades the installed packages
+	Upgrade() string
+	// Install installs packages without prompting
+	Install(packages []string) string
+	// Clean removes package caches so they don't end up in image layers
+	Clean() string
+	// BasePackages are the packages godot itself needs in the image
+	BasePackages() []string
+	// Locale configures the en_US.UTF-8 locale, it is empty when there's nothing to do
+	Locale() string
+	// AddUser creates a user with a home directory and bash as its shell. The user
+	// gets the IDs of the uid and gid build arguments when they are set.
+	AddUser(username string) []string
+}
+
+// Distro describes a Linux distribution godot can build images from
+type Distro struct {
+	Name           string
+	DefaultImage   string
+	PackageManager PackageManager
+}
+
+// distros are the supported distributions, keyed by name and alias
+var distros = map[string]Distro{
+	"debian":     {"debian", "debian:bookworm-slim", apt{}},
+	"ubuntu":     {"ubuntu", "ubuntu:24.04", apt{}},
+	"alpine":     {"alpine", "alpine:3.20", apk{}},
+	"fedora":     {"fedora", "fedora:40", dnf{}},
+	"rocky":      {"rocky", "rockylinux:9", dnf{}},
+	"centos":     {"centos", "quay.io/centos/centos:stream9", dnf{}},
+	"amazon":     {"amazon", "amazonlinux:2023", dnf{}},
+	"arch":       {"arch", "archlinux:latest", pacman{}},
+	"opensuse":   {"opensuse", "opensuse/leap:15.6", zypper{}},
+	"tumbleweed": {"tumbleweed", "opensuse/tumbleweed:latest", zypper{}},
+}
+
+// imageDistros maps image repository names to distributions
+var imageDistros = map[string]string{
+	"debian":      "debian",
+	"ubuntu":      "ubuntu",
+	"alpine":      "alpine",
+	"fedora":      "fedora",
+	"rockylinux":  "rocky",
+	"almalinux":   "rocky",
+	"centos":      "centos",
+	"amazonlinux": "amazon",
+	"archlinux":   "arch",
+	"leap":        "opensuse",
+	"tumbleweed":  "tumbleweed",
+}
+
+// DistroNames returns the names of the supported distributions, sorted
+func DistroNames() []string {
+	var names []string
+	for name := range distros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// distroFromImage guesses the distribution from an image reference such as
+// docker.io/library/alpine:3.19
+func distroFromImage(image string) (string, bool) {
+	name := image
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	name = name[strings.LastIndex(name, "/")+1:]
+	if colon := strings.Index(name, ":"); colon >= 0 {
+		name = name[:colon]
+	}
+	distro, ok := imageDistros[name]
+	return distro, ok
+}
+
+// ResolveDistro returns the base image and distribution a configuration builds
+// from. The distribution is guessed from base-image when distro isn't set.
+func (gdc *GoDotConfig) ResolveDistro() (string, Distro, error) {
+	name := gdc.Distro
+	if name == "" && gdc.BaseImage != "" {
+		guess, ok := distroFromImage(gdc.BaseImage)
+		if !ok {
+			return "", Distro{}, fmt.Errorf("Can't tell the distribution of base-image %s, set distro to one of: %s", gdc.BaseImage, strings.Join(DistroNames(), ", "))
+		}
+		name = guess
+	}
+	if name == "" {
+		name = defaultDistro
+	}
+	distro, ok := distros[strings.ToLower(name)]
+	if !ok {
+		return "", Distro{}, fmt.Errorf("Unknown distro %s, choose one of: %s", name, strings.Join(DistroNames(), ", "))
+	}
+	image := gdc.BaseImage
+	if image == "" {
+		image = distro.DefaultImage
+	}
+	return image, distro, nil
+}
+
+type apt struct{}
+
+func (apt) Name() string { return "apt-get" }
+func (apt) Upgrade() string {
+	return "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y upgrade"
+}
+
+// Install updates the package index first, Clean removes it after every install
+func (apt) Install(packages []string) string {
+	return "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y install " + strings.Join(packages, " ")
+}
+func (apt) Clean() string                { return "apt-get clean && rm -rf /var/lib/apt/lists/*" }
+func (apt) BasePackages() []string       { return []string{"curl", "make", "locales"} }
+func (apt) AddUser(user string) []string { return useradd(user) }
+func (apt) Locale() string {
+	return `echo "LC_ALL=en_US.UTF-8" >> /etc/environment && ` +
+		`echo "en_US.UTF-8 UTF-8" >> /etc/locale.gen && ` +
+		`echo "LANG=en_US.UTF-8" > /etc/locale.conf && ` +
+		`locale-gen en_US.UTF-8`
+}
+
+type apk struct{}
+
+func (apk) Name() string    { return "apk" }
+func (apk) Upgrade() string { return "apk update && apk upgrade" }
+func (apk) Install(packages []string) string {
+	return "apk add --no-cache " + strings.Join(packages, " ")
+}
+func (apk) Clean() string          { return "rm -rf /var/cache/apk/*" }
+func (apk) BasePackages() []string { return []string{"bash", "curl", "make"} }
+
+// Locale is empty, musl has no locale database to generate
+func (apk) Locale() string { return "" }
+
+// AddUser uses BusyBox's adduser, which takes a group name rather than a GID
+func (apk) AddUser(user string) []string {
+	return []string{
+		`if [ -n "$uid" ] && getent passwd "$uid" > /dev/null; then deluser "$(getent passwd "$uid" | cut -d: -f1)"; fi`,
+		`if [ -n "$gid" ] && ! getent group "$gid" > /dev/null; then addgroup -g "$gid" ` + user + `; fi`,
+		`adduser -D -s /bin/bash ${uid:+-u "$uid"} ${gid:+-G "$(getent group "$gid" | cut -d: -f1)"} ` + user,
+	}
+}
+
+type dnf struct{}
+
+func (dnf) Name() string    { return "dnf" }
+func (dnf) Upgrade() string { return "dnf -y upgrade" }
+
+// Install allows erasing packages, Fedora, CentOS Stream and Amazon Linux images ship
+// curl-minimal which conflicts with curl
+func (dnf) Install(packages []string) string {
+	return "dnf -y install --allowerasing " + strings.Join(packages, " ")
+}
+func (dnf) Clean() string { return "dnf clean all" }
+func (dnf) BasePackages() []string {
+	return []string{"curl", "make", "glibc-langpack-en", "shadow-utils"}
+}
+func (dnf) Locale() string               { return `echo "LANG=en_US.UTF-8" > /etc/locale.conf` }
+func (dnf) AddUser(user string) []string { return useradd(user) }
+
+type pacman struct{}
+
+func (pacman) Name() string    { return "pacman" }
+func (pacman) Upgrade() string { return "pacman -Syu --noconfirm" }
+func (pacman) Install(packages []string) string {
+	return "pacman -S --noconfirm --needed " + strings.Join(packages, " ")
+}
+func (pacman) Clean() string          { return "rm -rf /var/cache/pacman/pkg/*" }
+func (pacman) BasePackages() []string { return []string{"curl", "make"} }
+func (pacman) Locale() string {
+	return `sed -i 's/^#en_US.UTF-8/en_US.UTF-8/' /etc/locale.gen && locale-gen && ` +
+		`echo "LANG=en_US.UTF-8" > /etc/locale.conf`
+}
+func (pacman) AddUser(user string) []string { return useradd(user) }
+
+type zypper struct{}
+
+func (zypper) Name() string { return "zypper" }
+func (zypper) Upgrade() string {
+	return "zypper --non-interactive refresh && zypper --non-interactive update"
+}
+func (zypper) Install(packages []string) string {
+	return "zypper --non-interactive install " + strings.Join(packages, " ")
+}
+func (zypper) Clean() string { return "zypper clean --all" }
+func (zypper) BasePackages() []string {
+	return []string{"curl", "make", "glibc-locale", "shadow"}
+}
+func (zypper) Locale() string               { return `echo "LANG=en_US.UTF-8" > /etc/locale.conf` }
+func (zypper) AddUser(user string) []string { return useradd(user) }
+
+// useradd creates a user with the shadow utilities. A user already holding the
+// uid build argument, such as ubuntu in recent Ubuntu images, is removed, and a
+// group already holding gid becomes the user's primary group.
+func useradd(user string) []string {
+	return []string{
+		`if [ -n "$uid" ] && getent passwd "$uid" > /dev/null; then userdel "$(getent passwd "$uid" | cut -d: -f1)"; fi`,
+		`if [ -n "$gid" ] && ! getent group "$gid" > /dev/null; then groupadd -g "$gid" ` + user + `; fi`,
+		`useradd -m -s /bin/bash ${uid:+-u "$uid"} ${gid:+-g "$gid"} ` + user,
+	}
+}
@@ -0,0 +1,72 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveDistro(t *testing.T) {
+	tests := []struct {
+		gdc    GoDotConfig
+		image  string
+		distro string
+	}{
+		{GoDotConfig{}, "debian:bookworm-slim", "debian"},
+		{GoDotConfig{Distro: "alpine"}, "alpine:3.20", "alpine"},
+		{GoDotConfig{BaseImage: "docker.io/library/fedora:39"}, "docker.io/library/fedora:39", "fedora"},
+		{GoDotConfig{BaseImage: "archlinux@sha256:abc"}, "archlinux@sha256:abc", "arch"},
+		{GoDotConfig{BaseImage: "quay.io/centos/centos:stream9"}, "quay.io/centos/centos:stream9", "centos"},
+		{GoDotConfig{BaseImage: "registry.example.com/base:1", Distro: "opensuse"}, "registry.example.com/base:1", "opensuse"},
+	}
+	for _, test := range tests {
+		image, distro, err := test.gdc.ResolveDistro()
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.gdc, err)
+			continue
+		}
+		if image != test.image || distro.Name != test.distro {
+			t.Errorf("%+v: expected %s/%s, got %s/%s", test.gdc, test.image, test.distro, image, distro.Name)
+		}
+	}
+
+	if _, _, err := (&GoDotConfig{BaseImage: "registry.example.com/base:1"}).ResolveDistro(); err == nil {
+		t.Errorf("Expected an error for a base image of unknown distribution")
+	}
+	if _, _, err := (&GoDotConfig{Distro: "gentoo"}).ResolveDistro(); err == nil || !strings.Contains(err.Error(), "alpine") {
+		t.Errorf("Expected an unknown distro error listing distributions, got: %v", err)
+	}
+}
+
+func TestBuildDockerfileDistros(t *testing.T) {
+	tests := map[string][]string{
+		"debian":   {"FROM debian:bookworm-slim", "apt-get -y install git g++", "locale-gen en_US.UTF-8", `useradd -m -s /bin/bash ${uid:+-u "$uid"} ${gid:+-g "$gid"} $username`},
+		"alpine":   {"FROM alpine:3.20", "apk add --no-cache git g++", `deluser`, `adduser -D -s /bin/bash ${uid:+-u "$uid"}`},
+		"fedora":   {"FROM fedora:40", "dnf -y install --allowerasing git g++", "dnf clean all"},
+		"centos":   {"FROM quay.io/centos/centos:stream9", "dnf -y install --allowerasing git g++"},
+		"amazon":   {"FROM amazonlinux:2023", "dnf -y install --allowerasing git g++"},
+		"arch":     {"FROM archlinux:latest", "pacman -S --noconfirm --needed git g++", "rm -rf /var/cache/pacman/pkg/*", "locale-gen"},
+		"opensuse": {"FROM opensuse/leap:15.6", "zypper --non-interactive install git g++", "groupadd -g"},
+	}
+	for distro, expected := range tests {
+		gdc := &GoDotConfig{Username: "test-user", Distro: distro, Packages: []string{"git", "g++"}}
+		dockerfile, err := BuildDockerfile(gdc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", distro, err)
+			continue
+		}
+		for _, e := range expected {
+			if !strings.Contains(dockerfile, e) {
+				t.Errorf("%s: expected Dockerfile to contain %q:\n%s", distro, e, dockerfile)
+			}
+		}
+	}
+}
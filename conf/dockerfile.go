@@ -0,0 +1,145 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pmalmgren/godot/dockerfile"
+	"github.com/pmalmgren/godot/link"
+)
+
+// DockerfileFromConfig builds the Dockerfile instructions for a configuration
+func DockerfileFromConfig(gdc *GoDotConfig) (*dockerfile.Dockerfile, error) {
+	image, distro, err := gdc.ResolveDistro()
+	if err != nil {
+		return nil, err
+	}
+	pm := distro.PackageManager
+	home := "/home/$username"
+
+	df := &dockerfile.Dockerfile{}
+	df.Add(
+		dockerfile.From{Image: image},
+		dockerfile.Label{Labels: []dockerfile.KeyValue{{Key: "maintainer", Value: "Godot"}}},
+		dockerfile.Arg{Name: "username", Default: gdc.Username},
+		dockerfile.Arg{Name: "uid", Default: userID(gdc.UID)},
+		dockerfile.Arg{Name: "gid", Default: userID(gdc.GID)},
+		dockerfile.Comment{Text: "System setup"},
+		dockerfile.Run{Commands: []string{pm.Upgrade(), pm.Install(pm.BasePackages()), pm.Clean()}},
+	)
+	if len(gdc.Packages) > 0 {
+		df.Add(dockerfile.Run{Commands: []string{pm.Install(gdc.Packages), pm.Clean()}})
+	}
+
+	df.Add(
+		dockerfile.Comment{Text: "Locale"},
+		dockerfile.Env{Vars: []dockerfile.KeyValue{{Key: "LANG", Value: "en_US.UTF-8"}}},
+	)
+	if locale := pm.Locale(); locale != "" {
+		df.Add(dockerfile.Run{Commands: []string{locale}})
+	}
+
+	df.Add(
+		dockerfile.Comment{Text: "Create the user and copy over files"},
+		dockerfile.Run{Commands: pm.AddUser("$username")},
+	)
+	if scripts := gdc.scripts(); len(scripts) > 0 {
+		for _, script := range scripts {
+			df.Add(dockerfile.Copy{Sources: []string{script}, Dest: scriptPath(script)})
+		}
+		df.Add(dockerfile.Run{Commands: []string{"chmod -R a+rx " + scriptDirectory}})
+	}
+	for _, step := range gdc.SystemSetup {
+		df.Add(step.Instructions("")...)
+	}
+	df.Add(
+		dockerfile.Copy{Sources: []string{gdc.DotfileDirectory + "/"}, Dest: home + "/dotfiles/"},
+		dockerfile.Comment{Text: "User setup"},
+		dockerfile.User{Name: "$username"},
+		dockerfile.Workdir{Path: home + "/"},
+	)
+	for _, step := range gdc.UserSetup {
+		df.Add(step.Instructions("$username")...)
+	}
+
+	links, err := gdc.Links()
+	if err != nil {
+		return nil, err
+	}
+	if len(links) > 0 {
+		df.Add(
+			dockerfile.Comment{Text: "Link dotfiles"},
+			dockerfile.Run{Commands: link.Script(links, "~/dotfiles", gdc.Link.Conflict)},
+		)
+	}
+	df.Add(
+		dockerfile.Workdir{Path: home},
+		dockerfile.Cmd{Args: strings.Fields(gdc.EntryPoint)},
+	)
+	return df, nil
+}
+
+// Links plans the links of the dotfile directory into the home directory, secrets
+// are linked under their decrypted name
+func (gdc *GoDotConfig) Links() ([]link.Link, error) {
+	secrets, err := gdc.SecretFiles()
+	if err != nil {
+		return nil, err
+	}
+	opts := gdc.Link
+	opts.Made = make(map[string]string, len(secrets))
+	for _, rel := range secrets {
+		opts.Made[gdc.dotfilePath(rel, "")] = gdc.SecretPath(rel)
+	}
+	return link.Plan(gdc.HostPath(gdc.DotfileDirectory), opts)
+}
+
+// scripts returns the scripts run by setup steps, without duplicates
+func (gdc *GoDotConfig) scripts() []string {
+	var scripts []string
+	seen := map[string]bool{}
+	for _, step := range append(appendSteps(nil, gdc.SystemSetup), gdc.UserSetup...) {
+		if step.Script != "" && !seen[step.ContextPath()] {
+			seen[step.ContextPath()] = true
+			scripts = append(scripts, step.ContextPath())
+		}
+	}
+	return scripts
+}
+
+// ContextPaths returns the paths in the repository the image is built from: the
+// dotfile directory and the files used by setup steps outside of it
+func (gdc *GoDotConfig) ContextPaths() []string {
+	dotfiles := path.Clean(gdc.DotfileDirectory)
+	paths := []string{gdc.DotfileDirectory}
+	seen := map[string]bool{}
+	for _, step := range append(appendSteps(nil, gdc.SystemSetup), gdc.UserSetup...) {
+		p := step.ContextPath()
+		// a dotfile directory at the root holds everything but inherited files
+		inherited := strings.HasPrefix(p, extendsDirectory+"/")
+		if p == "" || seen[p] || (dotfiles == "." && !inherited) || p == dotfiles || strings.HasPrefix(p, dotfiles+"/") {
+			continue
+		}
+		seen[p] = true
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// userID formats a UID or GID build argument default, nil leaves it unset
+func userID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
@@ -0,0 +1,82 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildDockerfile(t *testing.T) {
+	r := writeRepo(t, map[string]string{})
+	defer removeRepo(t, r)
+	if err := os.MkdirAll(filepath.Join(r.RepoDirectory, "dotfiles", "zsh"), 0755); err != nil {
+		t.Fatalf("Error creating dotfiles directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.RepoDirectory, "dotfiles", "zsh", ".zshrc"), []byte(""), 0644); err != nil {
+		t.Fatalf("Error writing .zshrc: %v", err)
+	}
+
+	uid := 1000
+	gdc := &GoDotConfig{
+		RepoDirectory:    r.RepoDirectory,
+		Username:         "test-user",
+		UID:              &uid,
+		DotfileDirectory: "dotfiles",
+		Packages:         []string{"g++", "git"},
+		SystemSetup:      RawSteps(`RUN echo "system" > /etc/motd && true`),
+		UserSetup:        RawSteps("RUN mkdir user-setup"),
+		EntryPoint:       "tmux new -A",
+	}
+	expected := `FROM debian:bookworm-slim
+LABEL maintainer=Godot
+ARG username=test-user
+ARG uid=1000
+ARG gid
+
+# System setup
+RUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y upgrade && \
+    apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y install curl make locales && \
+    apt-get clean && rm -rf /var/lib/apt/lists/*
+RUN apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y install g++ git && \
+    apt-get clean && rm -rf /var/lib/apt/lists/*
+
+# Locale
+ENV LANG=en_US.UTF-8
+RUN echo "LC_ALL=en_US.UTF-8" >> /etc/environment && echo "en_US.UTF-8 UTF-8" >> /etc/locale.gen && echo "LANG=en_US.UTF-8" > /etc/locale.conf && locale-gen en_US.UTF-8
+
+# Create the user and copy over files
+RUN if [ -n "$uid" ] && getent passwd "$uid" > /dev/null; then userdel "$(getent passwd "$uid" | cut -d: -f1)"; fi && \
+    if [ -n "$gid" ] && ! getent group "$gid" > /dev/null; then groupadd -g "$gid" $username; fi && \
+    useradd -m -s /bin/bash ${uid:+-u "$uid"} ${gid:+-g "$gid"} $username
+RUN echo "system" > /etc/motd && true
+COPY dotfiles/ /home/$username/dotfiles/
+
+# User setup
+USER $username
+WORKDIR /home/$username/
+RUN mkdir user-setup
+
+# Link dotfiles
+RUN godot_link() { [ -e "$1" ] || [ -L "$1" ] || return 0; mkdir -p "$(dirname "$2")" || return 1; if [ -L "$2" ] && [ "$(readlink "$2")" = "$1" ]; then return 0; fi; if [ -e "$2" ] || [ -L "$2" ]; then b="$2.godot-backup"; n=1; while [ -e "$b" ] || [ -L "$b" ]; do b="$2.godot-backup.$n"; n=$((n + 1)); done; mv "$2" "$b" || return 1; fi; ln -s "$1" "$2"; } && \
+    godot_link ~/'dotfiles/zsh/.zshrc' ~/'.zshrc'
+WORKDIR /home/$username
+CMD ["tmux","new","-A"]
+`
+	actual, err := BuildDockerfile(gdc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,276 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// extendsDirectory is where the paths inherited from repositories extended by URL
+// are moved to, see Origins
+const extendsDirectory = ".godot/extends"
+
+// Resolve follows the `extends:` chain of a configuration read from src in r, and
+// returns the merged configuration. Paths are relative to the root of the
+// repository that contains the extending configuration, and git URLs are cloned.
+// A URL fragment names the configuration file in the cloned repository. With
+// trustedKeys, cloned repositories must be signed by one of them, see Pull.
+// Cloned repositories stay locked until the returned configuration is closed.
+func (gdc *GoDotConfig) Resolve(r Repository, src *Source, trustedKeys string) (*GoDotConfig, error) {
+	return gdc.resolve(r, []string{sourceID(r, src.Path)}, trustedKeys, true)
+}
+
+// resolve is Resolve, without fetch git URLs are only read from existing clones in
+// the cache
+func (gdc *GoDotConfig) resolve(r Repository, chain []string, trustedKeys string, fetch bool) (*GoDotConfig, error) {
+	if err := gdc.checkDotfileDirectories(); err != nil {
+		return nil, err
+	}
+	if gdc.Extends == "" {
+		resolved := *gdc
+		return &resolved, nil
+	}
+
+	baseRepo, name, cleanup, err := extendsRepository(r, gdc.Extends, trustedKeys, fetch)
+	if err != nil {
+		return nil, err
+	}
+	resolvedBase, err := gdc.resolveBase(baseRepo, name, chain, trustedKeys, fetch)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if baseRepo != r {
+		// the base's paths are relative to its own repository
+		prefix := path.Join(extendsDirectory, dirName(baseRepo.Source()))
+		resolvedBase.rebase(prefix)
+		resolvedBase.Origins = mergeMaps(resolvedBase.Origins, map[string]string{prefix: baseRepo.Directory()})
+	}
+	resolvedBase.release = append(resolvedBase.release, cleanup)
+	return resolvedBase.merge(gdc), nil
+}
+
+// checkDotfileDirectories checks that the dotfile directories of gdc and its
+// profiles don't leave the repository
+func (gdc *GoDotConfig) checkDotfileDirectories() error {
+	if err := repositoryPath(gdc.DotfileDirectory); err != nil {
+		return fmt.Errorf("Invalid dotfile-directory: %v", err)
+	}
+	for _, name := range gdc.ProfileNames() {
+		if err := repositoryPath(gdc.Profiles[name].DotfileDirectory); err != nil {
+			return fmt.Errorf("Invalid dotfile-directory of profile %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// resolveBase reads and resolves the configuration name in baseRepo that gdc extends
+func (gdc *GoDotConfig) resolveBase(baseRepo Repository, name string, chain []string, trustedKeys string, fetch bool) (*GoDotConfig, error) {
+	src, err := FindConfig(baseRepo, name)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", gdc.Extends, err)
+	}
+	id := sourceID(baseRepo, src.Path)
+	for _, seen := range chain {
+		if seen == id {
+			return nil, fmt.Errorf("Configuration extends itself: %s -> %s", strings.Join(chain, " -> "), id)
+		}
+	}
+
+	var base GoDotConfig
+	if err := src.Decode(&base); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", gdc.Extends, err)
+	}
+	return base.resolve(baseRepo, append(chain, id), trustedKeys, fetch)
+}
+
+// Close releases the cloned repositories the configuration's paths were inherited
+// from, after which the files in Origins may change
+func (gdc *GoDotConfig) Close() {
+	for _, release := range gdc.release {
+		release()
+	}
+	gdc.release = nil
+}
+
+// rebase moves the repository paths of gdc under prefix, except those already
+// moved to the repository they were inherited from
+func (gdc *GoDotConfig) rebase(prefix string) {
+	gdc.DotfileDirectory = rebasePath(prefix, gdc.DotfileDirectory)
+	gdc.SystemSetup = rebaseSteps(prefix, gdc.SystemSetup)
+	gdc.UserSetup = rebaseSteps(prefix, gdc.UserSetup)
+	var recipients []string
+	for _, recipient := range gdc.Secrets.Recipients {
+		recipients = append(recipients, rebasePath(prefix, recipient))
+	}
+	gdc.Secrets.Recipients = recipients
+	if len(gdc.Profiles) > 0 {
+		profiles := make(map[string]Profile, len(gdc.Profiles))
+		for name, profile := range gdc.Profiles {
+			profile.DotfileDirectory = rebasePath(prefix, profile.DotfileDirectory)
+			profile.SystemSetup = rebaseSteps(prefix, profile.SystemSetup)
+			profile.UserSetup = rebaseSteps(prefix, profile.UserSetup)
+			profiles[name] = profile
+		}
+		gdc.Profiles = profiles
+	}
+}
+
+// rebaseSteps returns steps with the scripts and copied files moved under prefix
+func rebaseSteps(prefix string, steps []Step) []Step {
+	if len(steps) == 0 {
+		return steps
+	}
+	rebased := make([]Step, len(steps))
+	for i, step := range steps {
+		step.Script = rebasePath(prefix, step.Script)
+		if step.Copy != nil {
+			copy := *step.Copy
+			copy.Src = rebasePath(prefix, copy.Src)
+			step.Copy = &copy
+		}
+		rebased[i] = step
+	}
+	return rebased
+}
+
+// rebasePath moves the repository path p under prefix, unless it's unset or
+// already inherited
+func rebasePath(prefix string, p string) string {
+	if p == "" || strings.HasPrefix(path.Clean(p), extendsDirectory+"/") {
+		return p
+	}
+	return path.Join(prefix, p)
+}
+
+// FilePath returns the full path of the file at rel in the repository, or in the
+// repository it was inherited from, and checks that it exists
+func (gdc *GoDotConfig) FilePath(rel string) (string, error) {
+	dir, rel := gdc.origin(rel)
+	return filePath(dir, filepath.FromSlash(rel))
+}
+
+// HostPath returns the full path of the file at rel in the repository, or in the
+// repository it was inherited from
+func (gdc *GoDotConfig) HostPath(rel string) string {
+	dir, rel := gdc.origin(rel)
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+// origin returns the directory of the repository the path rel comes from, and
+// the path in it
+func (gdc *GoDotConfig) origin(rel string) (string, string) {
+	clean := path.Clean(filepath.ToSlash(rel))
+	for prefix, dir := range gdc.Origins {
+		if clean == prefix || strings.HasPrefix(clean, prefix+"/") {
+			return dir, strings.TrimPrefix(strings.TrimPrefix(clean, prefix), "/")
+		}
+	}
+	return gdc.RepoDirectory, rel
+}
+
+// extendsRepository finds the repository and configuration file an `extends:` value
+// refers to. Remote repositories are cloned into the cache, see CachedRepository,
+// or without fetch only read from an existing clone, and cleanup releases them.
+func extendsRepository(r Repository, extends string, trustedKeys string, fetch bool) (repo Repository, name string, cleanup func(), err error) {
+	u, err := ParseRemote(extends)
+	if err != nil || u.Scheme == "" {
+		return r, filepath.ToSlash(filepath.Clean(extends)), func() {}, nil
+	}
+
+	name = u.Fragment
+	remote := *u
+	remote.Fragment = ""
+	if !fetch {
+		cloned, release, err := ExistingCachedRepository(&remote, trustedKeys)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("Error reading %s: %v", extends, err)
+		}
+		return cloned, name, release, nil
+	}
+	cloned, release, err := CachedRepository(&remote, "", trustedKeys)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("Error cloning %s: %v", extends, err)
+	}
+	return cloned, name, release, nil
+}
+
+// sourceID identifies a configuration file for cycle detection
+func sourceID(r Repository, path string) string {
+	return fmt.Sprintf("%s#%s", r.Source(), path)
+}
+
+// merge layers child over gdc: scalars set in child override, lists are appended,
+// profiles with the same name are replaced and RemovePackages drops inherited packages
+func (gdc *GoDotConfig) merge(child *GoDotConfig) *GoDotConfig {
+	merged := *child
+	merged.Extends = ""
+	merged.Origins = mergeMaps(gdc.Origins, child.Origins)
+	merged.release = gdc.release
+	merged.RemovePackages = nil
+	if merged.BaseImage == "" && merged.Distro == "" {
+		merged.BaseImage = gdc.BaseImage
+		merged.Distro = gdc.Distro
+	}
+	if merged.Username == "" {
+		merged.Username = gdc.Username
+	}
+	if merged.UID == nil {
+		merged.UID = gdc.UID
+	}
+	if merged.GID == nil {
+		merged.GID = gdc.GID
+	}
+	if merged.DotfileDirectory == "" {
+		merged.DotfileDirectory = gdc.DotfileDirectory
+	}
+	if merged.EntryPoint == "" {
+		merged.EntryPoint = gdc.EntryPoint
+	}
+	if merged.ImageTag == "" {
+		merged.ImageTag = gdc.ImageTag
+	}
+	merged.Packages = appendStrings(removeStrings(gdc.Packages, child.RemovePackages), child.Packages)
+	merged.SystemSetup = appendSteps(gdc.SystemSetup, child.SystemSetup)
+	merged.UserSetup = appendSteps(gdc.UserSetup, child.UserSetup)
+	if merged.Workdir == "" {
+		merged.Workdir = gdc.Workdir
+	}
+	merged.Volumes = appendStrings(gdc.Volumes, child.Volumes)
+	merged.Ports = appendStrings(gdc.Ports, child.Ports)
+	merged.Link = gdc.Link.Merge(child.Link)
+	merged.Secrets = gdc.Secrets.Merge(child.Secrets)
+	merged.Env = mergeMaps(gdc.Env, child.Env)
+	merged.Vars = mergeMaps(gdc.Vars, child.Vars)
+	if len(gdc.Profiles) > 0 {
+		merged.Profiles = make(map[string]Profile)
+		for name, profile := range gdc.Profiles {
+			merged.Profiles[name] = profile
+		}
+		for name, profile := range child.Profiles {
+			merged.Profiles[name] = profile
+		}
+	}
+	return &merged
+}
+
+// Dump serializes the configuration as YAML
+func (gdc *GoDotConfig) Dump() (string, error) {
+	out, err := yaml.Marshal(gdc)
+	if err != nil {
+		return "", fmt.Errorf("Error serializing configuration: %v", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,196 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commitRepo creates a Git repository containing files and returns its file:// URL
+func commitRepo(t *testing.T, files map[string]string) string {
+	r := writeRepo(t, files)
+	repo, err := git.PlainInit(r.RepoDirectory, false)
+	if err != nil {
+		t.Fatalf("Error initializing Git repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Error opening worktree: %v", err)
+	}
+	for name := range files {
+		if _, err := wt.Add(name); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+	_, err = wt.Commit("test", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Error committing: %v", err)
+	}
+	return "file://" + r.RepoDirectory
+}
+
+func TestResolveExtendsPath(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "extends: base.yaml\nusername: child-user\npackages: [zsh]\nremove-packages: [vim]\nuser-setup:\n  - RUN echo child\nports: [\"22\"]\nenv: {EDITOR: vim}\n",
+		"base.yaml":  "username: base-user\nimage-tag: base-env\npackages: [git, vim]\nuser-setup:\n  - RUN echo base\nports: [\"80\"]\nworkdir: /src\nenv: {EDITOR: nano, LANG: C}\n",
+	})
+	defer removeRepo(t, r)
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gdc.Username != "child-user" || gdc.ImageTag != "base-env" || gdc.Extends != "" {
+		t.Errorf("Unexpected scalars: %+v", gdc)
+	}
+	if expected := []string{"git", "zsh"}; !reflect.DeepEqual(gdc.Packages, expected) {
+		t.Errorf("Expected packages %v, got %v", expected, gdc.Packages)
+	}
+	if expected := RawSteps("RUN echo base", "RUN echo child"); !reflect.DeepEqual(gdc.UserSetup, expected) {
+		t.Errorf("Expected user-setup %v, got %v", expected, gdc.UserSetup)
+	}
+	if expected := []string{"80", "22"}; !reflect.DeepEqual(gdc.Ports, expected) || gdc.Workdir != "/src" {
+		t.Errorf("Expected ports %v and workdir /src, got %v and %s", expected, gdc.Ports, gdc.Workdir)
+	}
+	if expected := map[string]string{"EDITOR": "vim", "LANG": "C"}; !reflect.DeepEqual(gdc.Env, expected) {
+		t.Errorf("Expected env %v, got %v", expected, gdc.Env)
+	}
+}
+
+func TestResolveExtendsCycle(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "extends: a.yaml\n",
+		"a.yaml":     "extends: b.yaml\n",
+		"b.yaml":     "extends: godot.yaml\n",
+	})
+	defer removeRepo(t, r)
+
+	_, err := ConfigFromRepository(r, LoadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Fatalf("Expected a cycle error, got: %v", err)
+	}
+}
+
+func TestResolveDotfileDirectoryOutside(t *testing.T) {
+	tests := map[string]map[string]string{
+		"parent":   {"godot.yaml": "dotfile-directory: ../..\n"},
+		"absolute": {"godot.yaml": "dotfile-directory: /etc\n"},
+		"base":     {"godot.yaml": "extends: base.yaml\n", "base.yaml": "dotfile-directory: dotfiles/../../home\n"},
+		"profile":  {"godot.yaml": "dotfile-directory: .\nprofiles:\n  work:\n    dotfile-directory: ..\n"},
+	}
+	for name, files := range tests {
+		r := writeRepo(t, files)
+		_, err := ConfigFromRepository(r, LoadOptions{})
+		if err == nil || !strings.Contains(err.Error(), "must be a path inside the repository") {
+			t.Errorf("%s: expected an error for a dotfile directory outside the repository, got: %v", name, err)
+		}
+		removeRepo(t, r)
+	}
+}
+
+func TestResolveExtendsRemote(t *testing.T) {
+	remote := commitRepo(t, map[string]string{
+		"base.yaml": "username: base-user\nimage-tag: base-env\npackages: [git]\n",
+	})
+	defer func() {
+		if err := os.RemoveAll(strings.TrimPrefix(remote, "file://")); err != nil {
+			t.Logf("Error removing remote repository: %v", err)
+		}
+	}()
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "extends: " + remote + "#base.yaml\npackages: [zsh]\n",
+	})
+	defer removeRepo(t, r)
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gdc.Username != "base-user" || !reflect.DeepEqual(gdc.Packages, []string{"git", "zsh"}) {
+		t.Errorf("Unexpected configuration: %+v", gdc)
+	}
+
+	out, err := gdc.Dump()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(out, "extends") || !strings.Contains(out, "username: base-user") {
+		t.Errorf("Unexpected resolved configuration:\n%s", out)
+	}
+}
+
+func TestResolveExtendsRemoteFiles(t *testing.T) {
+	remote := commitRepo(t, map[string]string{
+		"base.yaml":            "uid: 1000\ndotfile-directory: dotfiles\nuser-setup:\n  - script: setup.sh\n  - copy: {src: files/motd, dest: /etc/motd}\n",
+		"setup.sh":             "echo base\n",
+		"files/motd":           "hello\n",
+		"dotfiles/vim/.vimrc":  "set nocompatible\n",
+		"dotfiles/sh/.profile": "export EDITOR=vim\n",
+	})
+	defer func() {
+		if err := os.RemoveAll(strings.TrimPrefix(remote, "file://")); err != nil {
+			t.Logf("Error removing remote repository: %v", err)
+		}
+	}()
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "extends: " + remote + "#base.yaml\nuid: 0\nuser-setup:\n  - script: child.sh\n",
+		"child.sh":   "echo child\n",
+	})
+	defer removeRepo(t, r)
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer gdc.Close()
+
+	if gdc.UID == nil || *gdc.UID != 0 {
+		t.Errorf("Expected uid 0 to override the base, got %v", gdc.UID)
+	}
+	if _, err := gdc.FilePath(gdc.DotfileDirectory); err != nil {
+		t.Errorf("Expected the inherited dotfile directory to exist: %v", err)
+	}
+	links, err := gdc.Links()
+	if err != nil || len(links) != 2 {
+		t.Errorf("Expected links to the base's dotfiles, got %v (%v)", links, err)
+	}
+	for _, p := range gdc.ContextPaths() {
+		if _, err := gdc.FilePath(p); err != nil {
+			t.Errorf("Expected the context path %s to exist: %v", p, err)
+		}
+	}
+	if len(gdc.Origins) != 1 || len(gdc.UserSetup) != 3 {
+		t.Fatalf("Expected one inherited repository and three steps, got %v and %v", gdc.Origins, gdc.UserSetup)
+	}
+	var clone string
+	for _, dir := range gdc.Origins {
+		clone = dir
+	}
+	for i, expected := range []string{
+		filepath.Join(clone, "setup.sh"),
+		filepath.Join(clone, "files", "motd"),
+		filepath.Join(r.RepoDirectory, "child.sh"),
+	} {
+		command, err := gdc.UserSetup[i].HostCommand(gdc.HostPath)
+		if err != nil || !strings.Contains(command, expected) {
+			t.Errorf("Expected user-setup step %d to use %s, got %q (%v)", i+1, expected, command, err)
+		}
+	}
+}
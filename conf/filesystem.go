@@ -0,0 +1,59 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	git "gopkg.in/src-d/go-git.v4"
+)
+
+// FilesystemRepository is a directory of dotfiles used as-is, such as a working tree
+// with uncommitted changes
+type FilesystemRepository struct {
+	RepoDirectory string
+}
+
+// Directory returns the repository's directory
+func (r *FilesystemRepository) Directory() string {
+	return r.RepoDirectory
+}
+
+// GetFilePath checks to see if a file or path exists
+func (r *FilesystemRepository) GetFilePath(path string) (string, error) {
+	return filePath(r.RepoDirectory, path)
+}
+
+// Head returns the SHA of the commit checked out in the Git working tree containing
+// the directory, or an empty string if there is none. Uncommitted changes aren't
+// part of the commit.
+func (r *FilesystemRepository) Head() (string, error) {
+	_, err := git.PlainOpenWithOptions(r.RepoDirectory, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == git.ErrRepositoryNotExists {
+		return "", nil
+	}
+	return head(r.RepoDirectory)
+}
+
+// Source returns the repository's directory
+func (r *FilesystemRepository) Source() string {
+	return r.RepoDirectory
+}
+
+// filePath returns the full path of path in dir if it exists
+func filePath(dir string, path string) (string, error) {
+	fullPath := filepath.Join(dir, path)
+	if _, err := os.Stat(fullPath); err != nil {
+		return "", fmt.Errorf("%s does not exist.", fullPath)
+	}
+	return fullPath, nil
+}
@@ -0,0 +1,37 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesystemRepositoryHead(t *testing.T) {
+	r := writeRepo(t, map[string]string{"godot.yaml": "username: test-user\n"})
+	defer removeRepo(t, r)
+	if sha, err := r.Head(); err != nil || sha != "" {
+		t.Errorf("Expected no commit outside a Git repository, got %q (%v)", sha, err)
+	}
+
+	dir := strings.TrimPrefix(commitRepo(t, map[string]string{"godot.yaml": "username: test-user\n"}), "file://")
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "dotfiles"), 0755); err != nil {
+		t.Fatalf("Error creating dotfiles directory: %v", err)
+	}
+	// a subdirectory of a working tree belongs to its commit
+	sub := &FilesystemRepository{RepoDirectory: filepath.Join(dir, "dotfiles")}
+	sha, err := sub.Head()
+	if err != nil || len(sha) != 40 {
+		t.Errorf("Expected the SHA of the working tree's commit, got %q (%v)", sha, err)
+	}
+}
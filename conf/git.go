@@ -11,30 +11,217 @@ package conf
 
 import (
 	"fmt"
+	"log"
+	"net/url"
 	"os"
 
 	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 )
 
-// Pull clones a Git repository into a directory
-func (r *Repository) Pull() error {
-	_, err := git.PlainClone(r.RepoDirectory, false, &git.CloneOptions{
-		URL:   r.Remote.String(),
-		Depth: 1,
-	})
+// GitRepository is a Git repository cloned from Remote into RepoDirectory
+type GitRepository struct {
+	RepoDirectory string
+	Remote        *url.URL
+	// Ref is the branch, tag or commit to check out, the default branch if empty
+	Ref string
+	// TrustedKeys is an armored keyring, when it's set the revision checked out
+	// must be signed by one of its keys
+	TrustedKeys string
+}
 
-	if err != nil && err != git.ErrRepositoryAlreadyExists {
-		return fmt.Errorf("Error cloning repository: %v", err)
+// Directory returns the directory the repository is cloned into
+func (r *GitRepository) Directory() string {
+	return r.RepoDirectory
+}
+
+// Pull clones the repository into RepoDirectory and checks out Ref, authenticating
+// as described in authMethod. When RepoDirectory already holds a clone, it is
+// fetched instead and checked out at the latest commit of the default branch, or
+// at Ref. A clone that can't be read is cloned again. With TrustedKeys, revisions
+// that aren't signed by a trusted key are refused and not checked out.
+func (r *GitRepository) Pull() error {
+	auth, err := authMethod(r.Remote)
+	if err != nil {
+		return fmt.Errorf("Error authenticating to %s: %v", r.Remote.Host, err)
+	}
+
+	repo, err := git.PlainOpen(r.RepoDirectory)
+	if err != git.ErrRepositoryNotExists {
+		if err == nil {
+			err = verify(repo)
+		}
+		if err == nil {
+			if err := fetch(repo, r.Source(), auth); err != nil {
+				return fmt.Errorf("Error fetching repository: %v", err)
+			}
+			branch, hash, err := r.target(repo)
+			if err != nil {
+				return err
+			}
+			if err := r.verifySignature(repo, hash); err != nil {
+				return err
+			}
+			if err = switchTo(repo, branch, hash); err == nil {
+				return nil
+			}
+		}
+		log.Printf("The clone in %s can't be used, cloning %s again: %v", r.RepoDirectory, r.Source(), err)
+		if err := os.RemoveAll(r.RepoDirectory); err != nil {
+			return fmt.Errorf("Error removing %s: %v", r.RepoDirectory, err)
+		}
 	}
 
+	// the URL is stored in the clone's configuration, so it mustn't hold credentials
+	repo, err = git.PlainClone(r.RepoDirectory, false, &git.CloneOptions{
+		URL:        r.Source(),
+		Auth:       auth,
+		NoCheckout: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Error cloning repository: %v", err)
+	}
+	branch, hash, err := r.target(repo)
+	if err != nil {
+		return err
+	}
+	if err := r.verifySignature(repo, hash); err != nil {
+		return err
+	}
+	if err := switchTo(repo, branch, hash); err != nil {
+		return fmt.Errorf("Error checking out %s: %v", hash, err)
+	}
 	return nil
 }
 
-// GetFile checks to see if a file or path exists
-func (r *Repository) GetFilePath(path string) (string, error) {
-	fullPath := fmt.Sprintf("%s/%s", r.RepoDirectory, path)
-	if _, err := os.Stat(fullPath); err != nil {
-		return "", fmt.Errorf("%s does not exist.", fullPath)
+// verify checks that the commit checked out in repo and its files can be read
+func verify(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	_, err = commit.Tree()
+	return err
+}
+
+// fetch fetches the branches and tags of the origin remote at url
+func fetch(repo *git.Repository, url string, auth transport.AuthMethod) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	origin, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok {
+		return fmt.Errorf("The clone has no %s remote", git.DefaultRemoteName)
+	}
+	if len(origin.URLs) != 1 || origin.URLs[0] != url {
+		origin.URLs = []string{url}
+		if err := repo.Storer.SetConfig(cfg); err != nil {
+			return err
+		}
+	}
+	err = repo.Fetch(&git.FetchOptions{Auth: auth, Tags: git.AllTags})
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+// target finds the commit to check out: Ref, which is a branch of the origin
+// remote, a tag or a full commit SHA, or the latest commit of the default branch.
+// Only the default branch is checked out as a local branch.
+func (r *GitRepository) target(repo *git.Repository) (plumbing.ReferenceName, plumbing.Hash, error) {
+	if r.Ref != "" {
+		var hash *plumbing.Hash
+		var err error
+		for _, rev := range []string{"refs/remotes/origin/" + r.Ref, "refs/tags/" + r.Ref, r.Ref} {
+			if hash, err = repo.ResolveRevision(plumbing.Revision(rev)); err == nil {
+				return "", *hash, nil
+			}
+		}
+		return "", plumbing.ZeroHash, fmt.Errorf("Error finding %s, expected a branch, a tag or a full commit SHA: %v", r.Ref, err)
 	}
-	return fullPath, nil
+
+	// cloning creates the default branch, and no other
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", plumbing.ZeroHash, fmt.Errorf("Error reading repository configuration: %v", err)
+	}
+	for name := range cfg.Branches {
+		ref, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name), true)
+		if err != nil {
+			return "", plumbing.ZeroHash, fmt.Errorf("Error finding branch %s: %v", name, err)
+		}
+		return plumbing.NewBranchReferenceName(name), ref.Hash(), nil
+	}
+	return "", plumbing.ZeroHash, fmt.Errorf("Error finding the default branch of the repository")
+}
+
+// switchTo checks out hash, discarding changes to the files. With a branch, the
+// branch is moved to hash and checked out.
+func switchTo(repo *git.Repository, branch plumbing.ReferenceName, hash plumbing.Hash) error {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if branch == "" {
+		return wt.Checkout(&git.CheckoutOptions{Hash: hash, Force: true})
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+		return err
+	}
+	return wt.Checkout(&git.CheckoutOptions{Branch: branch, Force: true})
+}
+
+// Head returns the SHA of the commit checked out in the repository
+func (r *GitRepository) Head() (string, error) {
+	return head(r.RepoDirectory)
+}
+
+// head returns the SHA of the commit checked out in the Git repository at dir
+func head(dir string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("Error opening repository: %v", err)
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("Error reading HEAD: %v", err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// Source returns the repository's remote without credentials or fragment, to
+// record where an image was built from
+func (r *GitRepository) Source() string {
+	return sourceURL(r.Remote)
+}
+
+// sourceURL returns remote without credentials or fragment
+func sourceURL(remote *url.URL) string {
+	if remote == nil {
+		return ""
+	}
+	if remote.Scheme == "" {
+		return remote.Path
+	}
+	u := *remote
+	u.Fragment = ""
+	// an SSH user name is no secret, but an HTTP one may be a token
+	if u.User != nil && (u.Scheme == "ssh" || u.Scheme == "git+ssh") {
+		u.User = url.User(u.User.Username())
+	} else {
+		u.User = nil
+	}
+	return u.String()
+}
+
+// GetFilePath checks to see if a file or path exists
+func (r *GitRepository) GetFilePath(path string) (string, error) {
+	return filePath(r.RepoDirectory, path)
 }
@@ -0,0 +1,220 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pmalmgren/godot/link"
+)
+
+// osReleaseFiles describe the host's distribution, the first one that exists is used
+var osReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// hostDistros maps os-release IDs to distributions
+var hostDistros = map[string]string{
+	"debian":              "debian",
+	"ubuntu":              "ubuntu",
+	"alpine":              "alpine",
+	"fedora":              "fedora",
+	"rocky":               "rocky",
+	"almalinux":           "rocky",
+	"rhel":                "rocky",
+	"centos":              "centos",
+	"amzn":                "amazon",
+	"arch":                "arch",
+	"opensuse":            "opensuse",
+	"opensuse-leap":       "opensuse",
+	"suse":                "opensuse",
+	"opensuse-tumbleweed": "tumbleweed",
+}
+
+// HostPlan is what godot apply does on the host
+type HostPlan struct {
+	// Install installs the configured packages as root, it is empty without packages
+	Install string
+	// Links link the dotfile directory into the home directory
+	Links []link.Link
+	// Commands are the user-setup steps translated to shell commands, in order
+	Commands []string
+	// Skipped explains the steps that can't run on the host
+	Skipped []string
+}
+
+// HostDistro returns the distribution of the host, as told by os-release
+func HostDistro() (Distro, error) {
+	for _, name := range osReleaseFiles {
+		contents, err := ioutil.ReadFile(name)
+		if err == nil {
+			return hostDistro(string(contents))
+		}
+	}
+	return Distro{}, fmt.Errorf("Can't tell the host's distribution, %s does not exist", osReleaseFiles[0])
+}
+
+// hostDistro finds the distribution of the os-release file contents by ID, or by
+// the distributions it's like
+func hostDistro(osRelease string) (Distro, error) {
+	values := map[string]string{}
+	for _, line := range strings.Split(osRelease, "\n") {
+		if eq := strings.Index(line, "="); eq > 0 {
+			values[strings.TrimSpace(line[:eq])] = strings.Trim(strings.TrimSpace(line[eq+1:]), `"'`)
+		}
+	}
+	ids := append([]string{values["ID"]}, strings.Fields(values["ID_LIKE"])...)
+	for _, id := range ids {
+		if name, ok := hostDistros[id]; ok {
+			return distros[name], nil
+		}
+	}
+	return Distro{}, fmt.Errorf("Unsupported host distribution %s, choose a host running one of: %s", values["ID"], strings.Join(DistroNames(), ", "))
+}
+
+// HostPlan plans installing the configuration on a host using pm. User-setup steps
+// run in the home directory, system-setup steps only make sense in the image.
+func (gdc *GoDotConfig) HostPlan(pm PackageManager) (*HostPlan, error) {
+	plan := &HostPlan{}
+	if len(gdc.Packages) > 0 {
+		plan.Install = pm.Install(gdc.Packages)
+	}
+	links, err := gdc.Links()
+	if err != nil {
+		return nil, err
+	}
+	plan.Links = links
+	for i, step := range gdc.SystemSetup {
+		plan.Skipped = append(plan.Skipped, fmt.Sprintf("system-setup step %d %s: system setup only runs in the image", i+1, step.describe()))
+	}
+	for i, step := range gdc.UserSetup {
+		command, err := step.HostCommand(gdc.HostPath)
+		if err != nil {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("user-setup step %d %s: %v", i+1, step.describe(), err))
+			continue
+		}
+		plan.Commands = append(plan.Commands, command)
+	}
+	return plan, nil
+}
+
+// Script returns a shell script running the plan's commands from the home
+// directory, stopping at the first failing one
+func (p *HostPlan) Script() string {
+	lines := []string{"set -e", `username="$(id -un)"`, `cd "$HOME"`}
+	return strings.Join(append(lines, p.Commands...), "\n") + "\n"
+}
+
+// describe returns a short description of the step for messages
+func (s *Step) describe() string {
+	switch {
+	case s.Raw != "":
+		return fmt.Sprintf("%q", s.Raw)
+	case s.Run != "":
+		return fmt.Sprintf("run %q", s.Run)
+	case s.Script != "":
+		return "script " + s.Script
+	case s.Copy != nil:
+		return "copy " + s.Copy.Src
+	case len(s.Env) > 0:
+		return "env"
+	}
+	return "workdir " + s.Workdir
+}
+
+// HostCommand translates the step to a shell command running on the host, like it
+// would in the image. Commands run in their own subshell, env and workdir steps
+// affect later commands. hostPath returns the full path of a repository file.
+func (s *Step) HostCommand(hostPath func(rel string) string) (string, error) {
+	switch {
+	case s.Raw != "":
+		return rawHostCommand(s.Raw)
+	case s.Run != "":
+		return subshell(s.inDir(runScript(s.Run))), nil
+	case s.Script != "":
+		return subshell(s.inDir(shellQuote(hostPath(path.Clean(s.Script))))), nil
+	case s.Copy != nil:
+		src := shellQuote(hostPath(path.Clean(s.Copy.Src)))
+		commands := []string{"cp -R " + src + " " + shellQuote(s.Copy.Dest)}
+		target := s.Copy.Dest
+		if strings.HasSuffix(target, "/") {
+			commands = append([]string{"mkdir -p " + shellQuote(target)}, commands...)
+			target = path.Join(target, path.Base(s.Copy.Src))
+		}
+		if s.Copy.Mode != "" {
+			commands = append(commands, "chmod -R "+s.Copy.Mode+" "+shellQuote(target))
+		}
+		return subshell(commands), nil
+	case len(s.Env) > 0:
+		names := make([]string, 0, len(s.Env))
+		for name := range s.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		exports := make([]string, len(names))
+		for i, name := range names {
+			exports[i] = name + "=" + shellQuote(s.Env[name])
+		}
+		return "export " + strings.Join(exports, " "), nil
+	case s.Workdir != "":
+		return "mkdir -p " + shellQuote(s.Workdir) + " && cd " + shellQuote(s.Workdir), nil
+	}
+	return "", fmt.Errorf("empty step")
+}
+
+// rawHostCommand translates a Dockerfile line. Only RUN, ENV and WORKDIR have a
+// meaning on the host.
+func rawHostCommand(raw string) (string, error) {
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty step")
+	}
+	instruction := strings.ToUpper(fields[0])
+	args := strings.TrimSpace(raw[len(fields[0]):])
+	switch instruction {
+	case "RUN":
+		if strings.HasPrefix(args, "[") {
+			var argv []string
+			if err := json.Unmarshal([]byte(args), &argv); err != nil {
+				return "", fmt.Errorf("Error parsing RUN arguments: %v", err)
+			}
+			for i, arg := range argv {
+				argv[i] = shellQuote(arg)
+			}
+			args = strings.Join(argv, " ")
+		}
+		return subshell([]string{args}), nil
+	case "ENV":
+		if len(fields) < 2 {
+			return "", fmt.Errorf("ENV needs a variable")
+		}
+		// the legacy form sets a single variable to the rest of the line
+		if !strings.Contains(fields[1], "=") {
+			return "export " + fields[1] + "=" + shellQuote(strings.TrimSpace(args[len(fields[1]):])), nil
+		}
+		return "export " + args, nil
+	case "WORKDIR":
+		return "mkdir -p " + args + " && cd " + args, nil
+	case "COPY", "ADD":
+		return "", fmt.Errorf("%s can't be applied on the host, use a copy step", instruction)
+	}
+	if !dockerfileInstructions[instruction] {
+		return "", fmt.Errorf("%s is not a Dockerfile instruction", fields[0])
+	}
+	return "", fmt.Errorf("%s can't be applied on the host", instruction)
+}
+
+// subshell runs commands in a subshell, so a cd doesn't affect later steps
+func subshell(commands []string) string {
+	return "(" + strings.Join(commands, " && ") + ")"
+}
@@ -0,0 +1,125 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHostDistro(t *testing.T) {
+	tests := map[string]string{
+		"ID=debian\nVERSION_ID=\"12\"\n":                          "debian",
+		"ID=\"amzn\"\nID_LIKE=\"centos rhel fedora\"\n":           "amazon",
+		"ID=linuxmint\nID_LIKE=\"ubuntu debian\"\n":               "ubuntu",
+		"ID=\"opensuse-tumbleweed\"\nID_LIKE=\"opensuse suse\"\n": "tumbleweed",
+	}
+	for osRelease, expected := range tests {
+		distro, err := hostDistro(osRelease)
+		if err != nil || distro.Name != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", osRelease, expected, distro.Name, err)
+		}
+	}
+	if _, err := hostDistro("ID=gentoo\n"); err == nil {
+		t.Errorf("Expected an error for an unsupported distribution")
+	}
+}
+
+func TestHostPlan(t *testing.T) {
+	gdc := &GoDotConfig{
+		RepoDirectory:    "/repo",
+		DotfileDirectory: "missing",
+		Packages:         []string{"git", "tmux"},
+		SystemSetup:      RawSteps("RUN echo system"),
+		UserSetup: append(RawSteps(
+			"RUN mkdir -p src",
+			`RUN ["echo", "it's"]`,
+			"ENV EDITOR vim",
+			"ENV PAGER=less LESS=-R",
+			"WORKDIR src",
+			"USER root",
+			"COPY bin /usr/local/bin",
+		), []Step{
+			{Run: "make", Dir: "~/tool"},
+			{Script: "scripts/setup.sh"},
+			{Copy: &CopyStep{Src: "bin/tool", Dest: "bin/", Mode: "0755"}},
+			{Env: map[string]string{"B": "2", "A": "1"}},
+			{Workdir: "projects"},
+		}...),
+	}
+	plan, err := gdc.HostPlan(apt{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &HostPlan{
+		Install: "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get -y install git tmux",
+		Commands: []string{
+			"(mkdir -p src)",
+			`('echo' 'it'\''s')`,
+			"export EDITOR='vim'",
+			"export PAGER=less LESS=-R",
+			"mkdir -p src && cd src",
+			"(cd ~/'tool' && make)",
+			"('/repo/scripts/setup.sh')",
+			"(mkdir -p 'bin/' && cp -R '/repo/bin/tool' 'bin/' && chmod -R 0755 'bin/tool')",
+			"export A='1' B='2'",
+			"mkdir -p 'projects' && cd 'projects'",
+		},
+		Skipped: []string{
+			`system-setup step 1 "RUN echo system": system setup only runs in the image`,
+			`user-setup step 6 "USER root": USER can't be applied on the host`,
+			`user-setup step 7 "COPY bin /usr/local/bin": COPY can't be applied on the host, use a copy step`,
+		},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, plan)
+	}
+}
+
+func TestHostPlanScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("No shell to run the script")
+	}
+	home, err := ioutil.TempDir("", "godot-home")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(home)
+
+	gdc := &GoDotConfig{UserSetup: append(RawSteps(
+		"RUN cd /",
+		"ENV GREETING hello world",
+		"WORKDIR projects",
+	), []Step{
+		{Run: `echo "$GREETING" > greeting`},
+		{Run: "pwd > dir", Dir: "~"},
+	}...)}
+	plan, err := gdc.HostPlan(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cmd := exec.Command(sh, "-c", plan.Script())
+	cmd.Env = append(os.Environ(), "HOME="+home)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Error running script: %v\n%s", err, out)
+	}
+	greeting, err := ioutil.ReadFile(filepath.Join(home, "projects", "greeting"))
+	if err != nil || string(greeting) != "hello world\n" {
+		t.Errorf("Expected the greeting in ~/projects, got %q (%v)", greeting, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "dir")); err != nil {
+		t.Errorf("Expected dir to run in the home directory: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// dockerfileInstructions are the instructions a setup step may start with
+var dockerfileInstructions = map[string]bool{
+	"ADD":         true,
+	"ARG":         true,
+	"CMD":         true,
+	"COPY":        true,
+	"ENTRYPOINT":  true,
+	"ENV":         true,
+	"EXPOSE":      true,
+	"FROM":        true,
+	"HEALTHCHECK": true,
+	"LABEL":       true,
+	"MAINTAINER":  true,
+	"ONBUILD":     true,
+	"RUN":         true,
+	"SHELL":       true,
+	"STOPSIGNAL":  true,
+	"USER":        true,
+	"VOLUME":      true,
+	"WORKDIR":     true,
+}
+
+// requiredFields are the configuration keys every godot configuration must set, either
+// directly or through the configuration it extends
+var requiredFields = []struct {
+	key   string
+	value func(*GoDotConfig) string
+}{
+	{"username", func(gdc *GoDotConfig) string { return gdc.Username }},
+	{"image-tag", func(gdc *GoDotConfig) string { return gdc.ImageTag }},
+	{"dotfile-directory", func(gdc *GoDotConfig) string { return gdc.DotfileDirectory }},
+	{"entrypoint", func(gdc *GoDotConfig) string { return gdc.EntryPoint }},
+}
+
+var yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Diagnostic is a problem found in a godot configuration
+type Diagnostic struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.Path, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.Path, d.Line, d.Message)
+}
+
+// Lint strictly checks a configuration source: unknown keys, wrong types, missing
+// required keys, a missing dotfile directory, setup steps that don't start with a
+// Dockerfile instruction or use missing files, `RUN cd` steps, invalid link
+// options and missing secret recipients are all reported. Git URLs in `extends:`
+// are only read from the cache unless fetch is set, and are checked with trustedKeys.
+func Lint(r Repository, src *Source, trustedKeys string, fetch bool) []Diagnostic {
+	var diagnostics []Diagnostic
+	doc, err := src.yamlDocument()
+	if err != nil {
+		return []Diagnostic{{Path: src.Path, Message: err.Error()}}
+	}
+	report := func(line int, format string, args ...interface{}) {
+		if line > 0 {
+			line = doc.Line(line)
+		}
+		diagnostics = append(diagnostics, Diagnostic{Path: src.Path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	raw := doc.Raw
+
+	var gdc GoDotConfig
+	if err := yaml.UnmarshalStrict([]byte(raw), &gdc); err != nil {
+		messages := []string{err.Error()}
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			messages = typeErr.Errors
+		}
+		for _, msg := range messages {
+			if match := yamlErrorPattern.FindStringSubmatch(msg); match != nil {
+				line, _ := strconv.Atoi(match[1])
+				report(line, "%s", match[2])
+			} else {
+				report(0, "%s", msg)
+			}
+		}
+		// a document that doesn't parse can't be checked any further
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return diagnostics
+		}
+	}
+
+	keys, items := yamlKeyLines(raw)
+
+	// a dotfile directory outside of the repository is reported here rather than
+	// as an error resolving extends
+	if err := repositoryPath(gdc.DotfileDirectory); err != nil {
+		report(keys["dotfile-directory"], "dotfile-directory %v", err)
+		gdc.DotfileDirectory = ""
+	}
+	for _, name := range gdc.ProfileNames() {
+		profile := gdc.Profiles[name]
+		if err := repositoryPath(profile.DotfileDirectory); err != nil {
+			line, _ := yamlPathLines(raw, "profiles", name, "dotfile-directory")
+			report(line, "profiles.%s.dotfile-directory %v", name, err)
+			profile.DotfileDirectory = ""
+			gdc.Profiles[name] = profile
+		}
+	}
+
+	resolved, err := gdc.resolve(r, []string{sourceID(r, src.Path)}, trustedKeys, fetch)
+	if err != nil {
+		report(keys["extends"], "%v", err)
+		return diagnostics
+	}
+	defer resolved.Close()
+	resolved.RepoDirectory = r.Directory()
+	// keys that are set but invalid have already been reported
+	var present map[string]interface{}
+	yaml.Unmarshal([]byte(raw), &present)
+	for _, field := range requiredFields {
+		if _, ok := present[field.key]; !ok && field.value(resolved) == "" {
+			// a missing key has no line
+			report(0, "missing required key %s", field.key)
+		}
+	}
+
+	if _, _, err := resolved.ResolveDistro(); err != nil {
+		line := keys["distro"]
+		if line == 0 {
+			line = keys["base-image"]
+		}
+		report(line, "%v", err)
+	}
+
+	if resolved.DotfileDirectory != "" {
+		path, err := resolved.FilePath(resolved.DotfileDirectory)
+		if err != nil {
+			report(keys["dotfile-directory"], "dotfile-directory %s does not exist in the repository", resolved.DotfileDirectory)
+		} else if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			report(keys["dotfile-directory"], "dotfile-directory %s is not a directory", resolved.DotfileDirectory)
+		}
+	}
+
+	if err := resolved.Link.Validate(); err != nil {
+		report(keys["link"], "%v", err)
+	}
+	for _, recipient := range resolved.Secrets.Recipients {
+		if _, err := resolved.FilePath(recipient); err != nil {
+			report(keys["secrets"], "recipient %s does not exist in the repository", recipient)
+		}
+	}
+
+	lintSteps := func(key string, steps []Step, lines []int, fallback int) {
+		for i, step := range steps {
+			line := fallback
+			if i < len(lines) {
+				line = lines[i]
+			}
+			if p := step.ContextPath(); p != "" {
+				if _, err := r.GetFilePath(p); err != nil {
+					report(line, "%s step %d uses %s, which does not exist in the repository", key, i+1, p)
+				}
+				continue
+			}
+			if step.Raw == "" {
+				continue
+			}
+			fields := strings.Fields(step.Raw)
+			if len(fields) == 0 {
+				report(line, "%s step %d is empty", key, i+1)
+				continue
+			}
+			if !dockerfileInstructions[strings.ToUpper(fields[0])] {
+				report(line, "%s step %q does not start with a Dockerfile instruction, did you mean \"RUN %s\"?", key, step.Raw, step.Raw)
+			} else if len(fields) == 3 && strings.ToUpper(fields[0]) == "RUN" && fields[1] == "cd" {
+				report(line, "%s step %q has no effect on later steps, use \"workdir: %s\" instead", key, step.Raw, fields[2])
+			}
+		}
+	}
+	lintSteps("system-setup", gdc.SystemSetup, items["system-setup"], keys["system-setup"])
+	lintSteps("user-setup", gdc.UserSetup, items["user-setup"], keys["user-setup"])
+	for _, name := range gdc.ProfileNames() {
+		profile := gdc.Profiles[name]
+		for _, key := range []string{"system-setup", "user-setup"} {
+			line, items := yamlPathLines(raw, "profiles", name, key)
+			if line == 0 {
+				line = keys["profiles"]
+			}
+			steps := profile.SystemSetup
+			if key == "user-setup" {
+				steps = profile.UserSetup
+			}
+			lintSteps("profiles."+name+"."+key, steps, items, line)
+		}
+	}
+
+	return diagnostics
+}
+
+// yamlPathLines finds the line of the nested key path in a YAML document, e.g.
+// profiles, work, user-setup, and the line of each block sequence item under it
+func yamlPathLines(raw string, path ...string) (int, []int) {
+	type key struct {
+		indent int
+		name   string
+	}
+	var stack []key
+	matches := func() bool {
+		if len(stack) != len(path) {
+			return false
+		}
+		for i, k := range stack {
+			if k.name != path[i] {
+				return false
+			}
+		}
+		return true
+	}
+	line := 0
+	var items []int
+	itemIndent := -1
+	for i, text := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			// a sequence may be indented like its key
+			for len(stack) > 0 && stack[len(stack)-1].indent > indent {
+				stack = stack[:len(stack)-1]
+			}
+			if matches() && (itemIndent == -1 || indent == itemIndent) {
+				itemIndent = indent
+				items = append(items, i+1)
+			}
+			continue
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, key{indent, strings.Trim(strings.TrimSpace(trimmed[:colon]), `"'`)})
+		if matches() && line == 0 {
+			line = i + 1
+		}
+	}
+	return line, items
+}
+
+// yamlKeyLines finds the line of each top-level key in a YAML document, and the
+// line of each block sequence item under it
+func yamlKeyLines(raw string) (map[string]int, map[string][]int) {
+	keys := make(map[string]int)
+	items := make(map[string][]int)
+	var current string
+	itemIndent := -1
+	for i, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 && !strings.HasPrefix(trimmed, "-") {
+			if colon := strings.Index(trimmed, ":"); colon > 0 {
+				current = strings.Trim(strings.TrimSpace(trimmed[:colon]), `"'`)
+				keys[current] = i + 1
+				itemIndent = -1
+			}
+			continue
+		}
+		if current == "" || (trimmed != "-" && !strings.HasPrefix(trimmed, "- ")) {
+			continue
+		}
+		if itemIndent == -1 {
+			itemIndent = indent
+		}
+		if indent == itemIndent {
+			items[current] = append(items[current], i+1)
+		}
+	}
+	return keys, items
+}
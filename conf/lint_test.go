@@ -0,0 +1,153 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"README.md": `# Test
+
+## godot configuration
+
+` + "```yaml" + `
+username: test-user
+image-tag: [test-dev-env]
+dotfile-directory: missing
+
+user_setup:
+  - RUN ls
+
+system-setup:
+  - RUN ls
+  - cd /tmp
+  - RUN cd /src
+  - script: missing.sh
+link:
+  targets:
+    bin: bin
+secrets:
+  recipients: [keys/me.asc]
+` + "```\n",
+	})
+	defer removeRepo(t, r)
+
+	src, err := FindConfig(r, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actual := Lint(r, src, "", false)
+	expected := []Diagnostic{
+		{Path: "README.md", Line: 7, Message: "cannot unmarshal !!seq into string"},
+		{Path: "README.md", Line: 10, Message: "field user_setup not found in type conf.GoDotConfig"},
+		{Path: "README.md", Message: "missing required key entrypoint"},
+		{Path: "README.md", Line: 8, Message: "dotfile-directory missing does not exist in the repository"},
+		{Path: "README.md", Line: 18, Message: "Target bin of bin must be absolute or start with ~"},
+		{Path: "README.md", Line: 21, Message: "recipient keys/me.asc does not exist in the repository"},
+		{Path: "README.md", Line: 15, Message: `system-setup step "cd /tmp" does not start with a Dockerfile instruction, did you mean "RUN cd /tmp"?`},
+		{Path: "README.md", Line: 16, Message: `system-setup step "RUN cd /src" has no effect on later steps, use "workdir: /src" instead`},
+		{Path: "README.md", Line: 17, Message: "system-setup step 4 uses missing.sh, which does not exist in the repository"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected != actual.\n%+v\n!=\n%+v", expected, actual)
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "username: test-user\nimage-tag: test-dev-env\ndotfile-directory: dotfiles\nentrypoint: zsh\nuser-setup:\n- RUN ls\n",
+	})
+	defer removeRepo(t, r)
+	if err := os.Mkdir(filepath.Join(r.RepoDirectory, "dotfiles"), 0755); err != nil {
+		t.Fatalf("Error creating dotfiles directory: %v", err)
+	}
+
+	src, err := FindConfig(r, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diagnostics := Lint(r, src, "", false); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestLintProfileLines(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "username: test-user\nimage-tag: test-dev-env\ndotfile-directory: .\nentrypoint: zsh\nprofiles:\n  work:\n    user-setup:\n      - RUN ls\n      - cd /tmp\n",
+	})
+	defer removeRepo(t, r)
+
+	src, err := FindConfig(r, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Diagnostic{
+		{Path: "godot.yaml", Line: 9, Message: `profiles.work.user-setup step "cd /tmp" does not start with a Dockerfile instruction, did you mean "RUN cd /tmp"?`},
+	}
+	if actual := Lint(r, src, "", false); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected != actual.\n%+v\n!=\n%+v", expected, actual)
+	}
+}
+
+func TestLintDotfileDirectoryOutside(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "username: test-user\nimage-tag: test-dev-env\ndotfile-directory: ../..\nentrypoint: zsh\nprofiles:\n  work:\n    dotfile-directory: /etc\n",
+	})
+	defer removeRepo(t, r)
+
+	src, err := FindConfig(r, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Diagnostic{
+		{Path: "godot.yaml", Line: 3, Message: "dotfile-directory ../.. must be a path inside the repository"},
+		{Path: "godot.yaml", Line: 7, Message: "profiles.work.dotfile-directory /etc must be a path inside the repository"},
+	}
+	if actual := Lint(r, src, "", false); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected != actual.\n%+v\n!=\n%+v", expected, actual)
+	}
+}
+
+func TestLintExtendsFetch(t *testing.T) {
+	remote := commitRepo(t, map[string]string{
+		"base.yaml": "username: base-user\nimage-tag: base-env\ndotfile-directory: .\nentrypoint: zsh\n",
+	})
+	defer func() {
+		if err := os.RemoveAll(strings.TrimPrefix(remote, "file://")); err != nil {
+			t.Logf("Error removing remote repository: %v", err)
+		}
+	}()
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": "packages: [git]\nextends: " + remote + "#base.yaml\n",
+	})
+	defer removeRepo(t, r)
+
+	src, err := FindConfig(r, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	diagnostics := Lint(r, src, "", false)
+	if len(diagnostics) != 1 || diagnostics[0].Line != 2 || !strings.Contains(diagnostics[0].Message, "isn't cached") {
+		t.Fatalf("Expected an uncached extends on line 2, got %+v", diagnostics)
+	}
+	if diagnostics := Lint(r, src, "", true); len(diagnostics) != 0 {
+		t.Fatalf("Expected no diagnostics with fetch, got %+v", diagnostics)
+	}
+	if diagnostics := Lint(r, src, "", false); len(diagnostics) != 0 {
+		t.Errorf("Expected the cached clone to be used, got %+v", diagnostics)
+	}
+}
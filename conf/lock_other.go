@@ -0,0 +1,45 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package conf
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// lockFile takes an exclusive lock on path by creating it, and waits while another
+// process holds it. The lock is released by the returned function. There is no
+// file locking on this platform, so a lock left behind by a crashed godot has to
+// be removed by hand.
+func lockFile(path string) (func(), error) {
+	waiting := false
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("Error creating lock %s: %v", path, err)
+		}
+		if !waiting {
+			log.Printf("Waiting for another godot using %s, remove it if no other godot is running", path)
+			waiting = true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
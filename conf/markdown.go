@@ -0,0 +1,220 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// confHeading is the heading text, at any level, that starts the godot configuration section
+const confHeading = "godot configuration"
+
+// fencedBlock is a fenced code block from the godot configuration section
+type fencedBlock struct {
+	info  string
+	lines []string
+	// lineNumbers holds the README line number of each entry in lines
+	lineNumbers []int
+}
+
+// readmeScan is the result of scanning a README for godot configuration
+type readmeScan struct {
+	sawHeader bool
+	blocks    []fencedBlock
+}
+
+// scanReadme walks a Markdown document following the CommonMark rules for ATX and
+// setext headings and fenced code blocks. It collects the yaml, yml and untagged
+// code blocks that sit in the godot configuration section, which ends at the next
+// heading of the same or a higher level.
+func scanReadme(contents string) (*readmeScan, error) {
+	scan := &readmeScan{}
+	var (
+		inSection    bool
+		sectionLevel int
+		inFence      bool
+		fenceChar    byte
+		fenceLen     int
+		fenceIndent  int
+		fenceStart   int
+		collecting   bool
+		block        fencedBlock
+		paragraph    []string
+	)
+
+	heading := func(level int, text string) {
+		if inSection && level <= sectionLevel {
+			inSection = false
+		}
+		if strings.EqualFold(strings.Join(strings.Fields(text), " "), confHeading) {
+			inSection = true
+			sectionLevel = level
+			scan.sawHeader = true
+		}
+	}
+
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		lineNumber := i + 1
+
+		if inFence {
+			if isClosingFence(line, fenceChar, fenceLen) {
+				inFence = false
+				if collecting {
+					scan.blocks = append(scan.blocks, block)
+				}
+				continue
+			}
+			if collecting {
+				block.lines = append(block.lines, trimIndent(line, fenceIndent))
+				block.lineNumbers = append(block.lineNumbers, lineNumber)
+			}
+			continue
+		}
+
+		if char, length, indent, info, ok := openingFence(line); ok {
+			inFence = true
+			fenceChar, fenceLen, fenceIndent, fenceStart = char, length, indent, lineNumber
+			collecting = inSection && isConfigInfo(info)
+			block = fencedBlock{info: info}
+			paragraph = nil
+			continue
+		}
+
+		if level, text, ok := atxHeading(line); ok {
+			heading(level, text)
+			paragraph = nil
+			continue
+		}
+
+		if level, ok := setextUnderline(line); ok && len(paragraph) > 0 {
+			heading(level, strings.Join(paragraph, " "))
+			paragraph = nil
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			paragraph = nil
+		} else {
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+
+	if inFence && collecting {
+		return nil, fmt.Errorf("the code block opened on line %d is never closed", fenceStart)
+	}
+	return scan, nil
+}
+
+// leadingSpaces counts the spaces at the start of line
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimIndent removes up to n leading spaces from line
+func trimIndent(line string, n int) string {
+	for i := 0; i < n && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// openingFence recognizes a line that opens a fenced code block
+func openingFence(line string) (char byte, length int, indent int, info string, ok bool) {
+	indent = leadingSpaces(line)
+	if indent > 3 {
+		return 0, 0, 0, "", false
+	}
+	rest := line[indent:]
+	if !strings.HasPrefix(rest, "```") && !strings.HasPrefix(rest, "~~~") {
+		return 0, 0, 0, "", false
+	}
+	char = rest[0]
+	for length < len(rest) && rest[length] == char {
+		length++
+	}
+	info = strings.TrimSpace(rest[length:])
+	if char == '`' && strings.Contains(info, "`") {
+		return 0, 0, 0, "", false
+	}
+	return char, length, indent, info, true
+}
+
+// isClosingFence recognizes a line that closes a fenced code block opened with length chars
+func isClosingFence(line string, char byte, length int) bool {
+	if leadingSpaces(line) > 3 {
+		return false
+	}
+	rest := strings.TrimSpace(line)
+	if len(rest) < length {
+		return false
+	}
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != char {
+			return false
+		}
+	}
+	return true
+}
+
+// isConfigInfo reports whether a fenced block's info string marks it as configuration
+func isConfigInfo(info string) bool {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return true
+	}
+	lang := strings.ToLower(fields[0])
+	return lang == "yaml" || lang == "yml"
+}
+
+// atxHeading recognizes a `#`-style heading and returns its level and text
+func atxHeading(line string) (int, string, bool) {
+	if leadingSpaces(line) > 3 {
+		return 0, "", false
+	}
+	rest := strings.TrimLeft(line, " ")
+	level := 0
+	for level < len(rest) && rest[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	text := rest[level:]
+	if text != "" && text[0] != ' ' && text[0] != '\t' {
+		return 0, "", false
+	}
+	text = strings.TrimSpace(text)
+	// strip an optional closing sequence of #s
+	trimmed := strings.TrimRight(text, "#")
+	if trimmed == "" || strings.HasSuffix(trimmed, " ") || strings.HasSuffix(trimmed, "\t") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return level, text, true
+}
+
+// setextUnderline recognizes the `===` or `---` line under a setext heading
+func setextUnderline(line string) (int, bool) {
+	if leadingSpaces(line) > 3 {
+		return 0, false
+	}
+	rest := strings.TrimSpace(line)
+	if rest == "" {
+		return 0, false
+	}
+	if strings.Trim(rest, "=") == "" {
+		return 1, true
+	}
+	if strings.Trim(rest, "-") == "" {
+		return 2, true
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanReadme(t *testing.T) {
+	contents := strings.Join([]string{
+		"# Dotfiles",
+		"",
+		"```yaml",
+		"username: ignored-outside-section",
+		"```",
+		"",
+		"### Godot Configuration   ",
+		"",
+		"~~~yml",
+		"# godot configuration",
+		"username: test-user",
+		"~~~",
+		"",
+		"```sh",
+		"echo not configuration",
+		"```",
+		"",
+		"  ````",
+		"  image-tag: test-dev-env",
+		"  ````",
+		"",
+		"#### Nested headings stay in the section",
+		"",
+		"```",
+		"packages: [git]",
+		"```",
+		"",
+		"Other section",
+		"-------------",
+		"",
+		"```yaml",
+		"username: ignored-after-section",
+		"```",
+	}, "\r\n")
+
+	scan, err := scanReadme(contents)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !scan.sawHeader {
+		t.Fatalf("Expected the configuration heading to be found")
+	}
+	var lines []string
+	var lineNumbers []int
+	for _, block := range scan.blocks {
+		lines = append(lines, block.lines...)
+		lineNumbers = append(lineNumbers, block.lineNumbers...)
+	}
+	expectedLines := []string{"# godot configuration", "username: test-user", "image-tag: test-dev-env", "packages: [git]"}
+	if !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Expected lines %q, got %q", expectedLines, lines)
+	}
+	if expectedNumbers := []int{10, 11, 19, 25}; !reflect.DeepEqual(lineNumbers, expectedNumbers) {
+		t.Errorf("Expected line numbers %v, got %v", expectedNumbers, lineNumbers)
+	}
+}
+
+func TestScanReadmeUnclosedFence(t *testing.T) {
+	_, err := scanReadme("## godot configuration\n\n```yaml\nusername: test-user\n")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("Expected an unclosed code block error on line 3, got: %v", err)
+	}
+}
+
+func TestReadmeDuplicateKeys(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"README.md": "# Test\n\n## godot configuration\n\n```yaml\nusername: test-user\npackages: [git]\n```\n\n```yaml\nimage-tag: test-env\npackages: [vim]\n```\n",
+	})
+	defer removeRepo(t, r)
+
+	_, err := ConfigFromReadme(r)
+	if err == nil || !strings.Contains(err.Error(), "packages is set at line 7 and again at line 12") {
+		t.Fatalf("Expected an error naming both lines of packages, got: %v", err)
+	}
+}
+
+func TestReadmeErrorLineNumbers(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"README.md": "# Test\n\n## godot configuration\n\n```yaml\nusername: test-user\n```\n\n```yaml\npackages: {\n```\n",
+	})
+	defer removeRepo(t, r)
+
+	_, err := ConfigFromReadme(r)
+	if err == nil || !strings.Contains(err.Error(), "README.md") || !strings.Contains(err.Error(), "line 10") {
+		t.Fatalf("Expected an error pointing at README.md line 10, got: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+//go:build linux || darwin
+// +build linux darwin
+
+package conf
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether the file described by fi belongs to the user running
+// godot
+func ownedByUser(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,117 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProfileNames returns the names of the configuration's profiles, sorted
+func (gdc *GoDotConfig) ProfileNames() []string {
+	var names []string
+	for name := range gdc.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns a copy of the configuration with the named profile applied.
+// An empty name returns an unchanged copy.
+func (gdc *GoDotConfig) WithProfile(name string) (*GoDotConfig, error) {
+	merged := *gdc
+	if name == "" {
+		return &merged, nil
+	}
+	profile, ok := gdc.Profiles[name]
+	if !ok {
+		if len(gdc.Profiles) == 0 {
+			return nil, fmt.Errorf("Unknown profile %s, the configuration has no profiles", name)
+		}
+		return nil, fmt.Errorf("Unknown profile %s, choose one of: %s", name, strings.Join(gdc.ProfileNames(), ", "))
+	}
+
+	merged.Profile = name
+	if profile.BaseImage != "" || profile.Distro != "" {
+		// the base distribution is replaced as a whole
+		merged.BaseImage = profile.BaseImage
+		merged.Distro = profile.Distro
+	}
+	if profile.DotfileDirectory != "" {
+		merged.DotfileDirectory = profile.DotfileDirectory
+	}
+	if profile.EntryPoint != "" {
+		merged.EntryPoint = profile.EntryPoint
+	}
+	if profile.ImageTag != "" {
+		merged.ImageTag = profile.ImageTag
+	}
+	merged.Packages = removeStrings(appendStrings(gdc.Packages, profile.Packages), profile.RemovePackages)
+	merged.SystemSetup = appendSteps(gdc.SystemSetup, profile.SystemSetup)
+	merged.UserSetup = appendSteps(gdc.UserSetup, profile.UserSetup)
+	merged.Vars = mergeMaps(gdc.Vars, profile.Vars)
+	return &merged, nil
+}
+
+// mergeMaps returns a copy of base with the values of extra added or replacing its
+// own, or extra itself when base is empty
+func mergeMaps(base map[string]string, extra map[string]string) map[string]string {
+	if len(base) == 0 {
+		return extra
+	}
+	merged := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// appendStrings appends extra to a copy of base, so merged configurations never share arrays
+func appendStrings(base []string, extra []string) []string {
+	if len(base) == 0 && len(extra) == 0 {
+		return base
+	}
+	merged := make([]string, 0, len(base)+len(extra))
+	merged = append(merged, base...)
+	return append(merged, extra...)
+}
+
+// appendSteps appends extra to a copy of base, like appendStrings
+func appendSteps(base []Step, extra []Step) []Step {
+	if len(base) == 0 && len(extra) == 0 {
+		return base
+	}
+	merged := make([]Step, 0, len(base)+len(extra))
+	merged = append(merged, base...)
+	return append(merged, extra...)
+}
+
+// removeStrings returns list without the entries in remove
+func removeStrings(list []string, remove []string) []string {
+	if len(remove) == 0 {
+		return list
+	}
+	removed := make(map[string]bool)
+	for _, s := range remove {
+		removed[s] = true
+	}
+	var kept []string
+	for _, s := range list {
+		if !removed[s] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
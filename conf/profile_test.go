@@ -0,0 +1,69 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFromRepositoryProfile(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": `username: test-user
+image-tag: dev-env
+entrypoint: bash
+dotfile-directory: dotfiles
+packages: [git]
+user-setup:
+  - RUN echo base
+
+profiles:
+  work:
+    image-tag: dev-env-work
+    entrypoint: zsh
+    packages: [zsh, tmux]
+    user-setup:
+      - RUN echo work
+  minimal: {}
+`,
+	})
+	defer removeRepo(t, r)
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{Profile: "work"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gdc.Profile != "work" || gdc.ImageTag != "dev-env-work" || gdc.EntryPoint != "zsh" || gdc.DotfileDirectory != "dotfiles" {
+		t.Errorf("Profile scalars not applied: %+v", gdc)
+	}
+	if expected := []string{"git", "zsh", "tmux"}; !reflect.DeepEqual(gdc.Packages, expected) {
+		t.Errorf("Expected packages %v, got %v", expected, gdc.Packages)
+	}
+	if expected := RawSteps("RUN echo base", "RUN echo work"); !reflect.DeepEqual(gdc.UserSetup, expected) {
+		t.Errorf("Expected user-setup %v, got %v", expected, gdc.UserSetup)
+	}
+	if !strings.Contains(gdc.DockerfileRendered, "RUN echo work") {
+		t.Errorf("Profile not rendered into the Dockerfile:\n%s", gdc.DockerfileRendered)
+	}
+
+	base, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if base.ImageTag != "dev-env" || !reflect.DeepEqual(base.Packages, []string{"git"}) {
+		t.Errorf("Base configuration changed by profile: %+v", base)
+	}
+
+	_, err = ConfigFromRepository(r, LoadOptions{Profile: "personal"})
+	if err == nil || !strings.Contains(err.Error(), "minimal, work") {
+		t.Errorf("Expected an unknown profile error listing profiles, got: %v", err)
+	}
+}
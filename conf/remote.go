@@ -0,0 +1,72 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// shorthands are the provider prefixes accepted in place of a repository URL,
+// e.g. gh:user/repo
+var shorthands = map[string]string{
+	"gh": "https://github.com/",
+	"gl": "https://gitlab.com/",
+	"bb": "https://bitbucket.org/",
+}
+
+// scpRemote matches scp-style remotes such as git@github.com:user/repo.git
+var scpRemote = regexp.MustCompile(`^(?:([^@/:]+)@)?([^@/:]{2,}):([^/].*|/.*)$`)
+
+// windowsPath matches absolute Windows paths, whose drive letter would otherwise
+// be taken for a URL scheme
+var windowsPath = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+
+// ParseRemote parses a repository given on the command line or in `extends:`. Besides
+// URLs and local paths it accepts scp-style remotes, which become ssh:// URLs, and
+// provider shorthands. A #fragment is kept in the URL's Fragment.
+func ParseRemote(s string) (*url.URL, error) {
+	if strings.Contains(s, "://") {
+		return url.Parse(s)
+	}
+	if windowsPath.MatchString(s) {
+		return &url.URL{Path: s}, nil
+	}
+	remote, fragment := s, ""
+	if i := strings.Index(s, "#"); i >= 0 {
+		remote, fragment = s[:i], s[i+1:]
+	}
+
+	if i := strings.Index(remote, ":"); i > 0 {
+		if base, ok := shorthands[remote[:i]]; ok {
+			path := strings.TrimPrefix(remote[i+1:], "/")
+			if strings.Count(strings.TrimSuffix(path, "/"), "/") != 1 {
+				return nil, fmt.Errorf("Invalid repository %s, expected %s:user/repo", s, remote[:i])
+			}
+			u, err := url.Parse(base + path)
+			if err != nil {
+				return nil, err
+			}
+			u.Fragment = fragment
+			return u, nil
+		}
+	}
+
+	if m := scpRemote.FindStringSubmatch(remote); m != nil {
+		u := &url.URL{Scheme: "ssh", Host: m[2], Path: "/" + strings.TrimPrefix(m[3], "/"), Fragment: fragment}
+		if m[1] != "" {
+			u.User = url.User(m[1])
+		}
+		return u, nil
+	}
+	return url.Parse(s)
+}
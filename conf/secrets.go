@@ -0,0 +1,126 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pmalmgren/godot/secret"
+	"golang.org/x/crypto/openpgp"
+)
+
+// SecretFiles returns the encrypted files of the dotfile directory, by their path in
+// the repository using forward slashes. Armored files that aren't messages, such
+// as the public keys of secrets.recipients, are ordinary dotfiles.
+func (gdc *GoDotConfig) SecretFiles() ([]string, error) {
+	recipients := map[string]bool{}
+	for _, name := range gdc.Secrets.Recipients {
+		recipients[path.Clean(filepath.ToSlash(name))] = true
+	}
+	var files []string
+	err := gdc.walkDotfiles(secret.Suffixes, func(rel string, p string) error {
+		if recipients[rel] {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if secret.Encrypted(rel, contents) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error finding secrets: %v", err)
+	}
+	return files, nil
+}
+
+// SecretPath returns the path in the dotfile directory the secret at rel in the
+// repository is decrypted to
+func (gdc *GoDotConfig) SecretPath(rel string) string {
+	name, _ := secret.Name(rel)
+	return gdc.dotfilePath(name, "")
+}
+
+// DecryptSecrets decrypts the encrypted files of the dotfile directory with d. The
+// plaintexts are keyed by the path of their encrypted file in the repository.
+func (gdc *GoDotConfig) DecryptSecrets(d secret.Decrypter) (map[string][]byte, error) {
+	files, err := gdc.SecretFiles()
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make(map[string][]byte, len(files))
+	for _, rel := range files {
+		ciphertext, err := ioutil.ReadFile(gdc.HostPath(rel))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading secret %s: %v", rel, err)
+		}
+		plaintext, err := d.Decrypt(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting secret %s: %v", rel, err)
+		}
+		decrypted[rel] = plaintext
+	}
+	return decrypted, nil
+}
+
+// WriteSecrets decrypts the encrypted files of the dotfile directory with d into
+// dir, at their SecretPath, with permissions perm. It returns the written paths
+// relative to dir, using forward slashes.
+func (gdc *GoDotConfig) WriteSecrets(d secret.Decrypter, dir string, perm os.FileMode) ([]string, error) {
+	decrypted, err := gdc.DecryptSecrets(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Error creating %s: %v", dir, err)
+	}
+	var written []string
+	for rel, plaintext := range decrypted {
+		name := gdc.SecretPath(rel)
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), plaintext, perm); err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+// Recipients reads the public keys new secrets are encrypted for: the key files
+// configured in secrets.recipients, in the repository, and the extra key files
+func (gdc *GoDotConfig) Recipients(extra []string) (openpgp.EntityList, error) {
+	var files []string
+	for _, name := range gdc.Secrets.Recipients {
+		files = append(files, gdc.HostPath(name))
+	}
+	files = append(files, extra...)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No recipients, set secrets.recipients or pass --recipient")
+	}
+	var recipients openpgp.EntityList
+	for _, name := range files {
+		contents, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading recipient: %v", err)
+		}
+		keys, err := secret.ReadKeys(contents)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading recipient %s: %v", name, err)
+		}
+		recipients = append(recipients, keys...)
+	}
+	return recipients, nil
+}
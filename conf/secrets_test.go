@@ -0,0 +1,113 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pmalmgren/godot/link"
+)
+
+// reverse "decrypts" secrets by reversing them
+type reverse struct{}
+
+func (reverse) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("empty secret")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	for i, b := range ciphertext {
+		plaintext[len(ciphertext)-1-i] = b
+	}
+	return plaintext, nil
+}
+
+func TestWriteSecrets(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"dotfiles/net/.netrc.gpg":       "terces",
+		"dotfiles/ssh/.ssh/id_rsa.asc":  "\n-----BEGIN PGP MESSAGE-----",
+		"dotfiles/zsh/.zshrc":           "export A=1",
+		"dotfiles/.git/objects/x.gpg":   "",
+		"scripts/not-a-dotfile.txt.gpg": "",
+	})
+	defer removeRepo(t, r)
+	gdc := &GoDotConfig{RepoDirectory: r.RepoDirectory, DotfileDirectory: "dotfiles"}
+
+	files, err := gdc.SecretFiles()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"dotfiles/net/.netrc.gpg", "dotfiles/ssh/.ssh/id_rsa.asc"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	dir, err := ioutil.TempDir("", "godot-secrets")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	written, err := gdc.WriteSecrets(reverse{}, dir, 0600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sort.Strings(written)
+	if expected := []string{"net/.netrc", "ssh/.ssh/id_rsa"}; !reflect.DeepEqual(written, expected) {
+		t.Errorf("Expected %v, got %v", expected, written)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "net", ".netrc"))
+	if err != nil || !bytes.Equal(contents, []byte("secret")) {
+		t.Errorf("Expected the decrypted .netrc, got %q (%v)", contents, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "ssh", ".ssh", "id_rsa")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected id_rsa to be private, got %v (%v)", info, err)
+	}
+}
+
+func TestSecretFilesRecipients(t *testing.T) {
+	r := writeRepo(t, map[string]string{
+		"keys/me.asc":         "-----BEGIN PGP PUBLIC KEY BLOCK-----\n",
+		"keys/other.asc":      "-----BEGIN PGP PUBLIC KEY BLOCK-----\n",
+		"keys/listed.asc":     "-----BEGIN PGP MESSAGE-----\n",
+		"ssh/.ssh/id_rsa.asc": "-----BEGIN PGP MESSAGE-----\n",
+	})
+	defer removeRepo(t, r)
+	gdc := &GoDotConfig{RepoDirectory: r.RepoDirectory, DotfileDirectory: "."}
+	gdc.Secrets.Recipients = []string{"./keys/me.asc", "keys/listed.asc"}
+
+	decrypted, err := gdc.DecryptSecrets(reverse{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := decrypted["ssh/.ssh/id_rsa.asc"]; !ok || len(decrypted) != 1 {
+		t.Errorf("Expected only id_rsa.asc to be decrypted, got %v", decrypted)
+	}
+
+	links, err := gdc.Links()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []link.Link{
+		{Source: "ssh/.ssh/id_rsa", Target: "~/.ssh/id_rsa", From: "ssh/.ssh/id_rsa.asc"},
+		{Source: "keys/listed.asc", Target: "~/listed.asc"},
+		{Source: "keys/me.asc", Target: "~/me.asc"},
+		{Source: "keys/other.asc", Target: "~/other.asc"},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, links)
+	}
+}
@@ -0,0 +1,217 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pmalmgren/godot/secret"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Settings are the user's own settings, which apply to every repository
+type Settings struct {
+	// VerifySignature checks the signatures of cloned repositories without
+	// --verify-signature
+	VerifySignature bool `yaml:"verify-signature,omitempty"`
+	// TrustedKeys are the public key files cloned revisions must be signed by
+	TrustedKeys []string `yaml:"trusted-keys,omitempty"`
+}
+
+// SettingsPath returns the file the user's settings are read from,
+// $XDG_CONFIG_HOME/godot/settings.yaml
+func SettingsPath() (string, error) {
+	dir, err := xdgDirectory("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "settings.yaml"), nil
+}
+
+// LoadSettings reads the user's settings, which are empty if the file doesn't exist
+func LoadSettings() (*Settings, error) {
+	path, err := SettingsPath()
+	if err != nil {
+		return nil, err
+	}
+	settings := &Settings{}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading settings: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(contents, settings); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// Keyring reads the trusted keys into an armored keyring, key files may be armored
+// or not and start with ~
+func (s *Settings) Keyring() (string, error) {
+	if len(s.TrustedKeys) == 0 {
+		path, _ := SettingsPath()
+		return "", fmt.Errorf("No trusted keys to verify signatures with, list public key files in trusted-keys in %s", path)
+	}
+	var out bytes.Buffer
+	w, err := armor.Encode(&out, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error reading trusted keys: %v", err)
+	}
+	for _, name := range s.TrustedKeys {
+		expanded, err := homedir.Expand(name)
+		if err != nil {
+			return "", fmt.Errorf("Error expanding %s: %v", name, err)
+		}
+		contents, err := ioutil.ReadFile(expanded)
+		if err != nil {
+			return "", fmt.Errorf("Error reading trusted key: %v", err)
+		}
+		keys, err := secret.ReadKeys(contents)
+		if err != nil {
+			return "", fmt.Errorf("Error reading trusted key %s: %v", name, err)
+		}
+		for _, key := range keys {
+			if err := key.Serialize(w); err != nil {
+				return "", fmt.Errorf("Error reading trusted key %s: %v", name, err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("Error reading trusted keys: %v", err)
+	}
+	return out.String(), nil
+}
+
+// verifySignature checks that the commit hash about to be checked out is signed by
+// one of the trusted keys, or that Ref is a tag of it signed by one. It does
+// nothing without trusted keys.
+func (r *GitRepository) verifySignature(repo *git.Repository, hash plumbing.Hash) error {
+	if r.TrustedKeys == "" {
+		return nil
+	}
+	var tags []string
+	if r.Ref != "" {
+		tags = append(tags, r.Ref)
+	}
+	return verifyRevision(repo, hash, tags, r.TrustedKeys, r.Source())
+}
+
+// VerifyDirectory checks that the Git repository in dir has no uncommitted changes
+// and that its HEAD commit, or a tag of it, is signed by one of trustedKeys, since
+// a local directory is used as it is
+func VerifyDirectory(dir string, trustedKeys string) error {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return fmt.Errorf("%s isn't a Git repository, so its signature can't be verified: %v", dir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("Error reading HEAD: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("Error opening worktree: %v", err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("Error reading the status of %s: %v", dir, err)
+	}
+	if !status.IsClean() {
+		return fmt.Errorf("%s has uncommitted changes, which aren't signed, commit them or use --ref", dir)
+	}
+	var tags []string
+	iter, err := repo.Tags()
+	if err != nil {
+		return fmt.Errorf("Error reading tags: %v", err)
+	}
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	return verifyRevision(repo, head.Hash(), tags, trustedKeys, dir)
+}
+
+// verifyRevision checks that one of the annotated tags of hash named tags, or else
+// the commit itself, is signed by one of trustedKeys. source names the repository
+// in messages.
+func verifyRevision(repo *git.Repository, hash plumbing.Hash, tags []string, trustedKeys string, source string) error {
+	var tagErr error
+	for _, name := range tags {
+		ref, err := repo.Reference(plumbing.NewTagReferenceName(name), true)
+		if err != nil {
+			continue
+		}
+		// lightweight tags aren't objects, their commit has to be signed
+		tag, err := repo.TagObject(ref.Hash())
+		if err != nil || tag.PGPSignature == "" || tag.Target != hash {
+			continue
+		}
+		signer, err := tag.Verify(trustedKeys)
+		if err == nil {
+			log.Printf("Tag %s is signed by %s", name, identity(signer))
+			return nil
+		}
+		if tagErr == nil {
+			tagErr = signatureError(fmt.Sprintf("Tag %s of %s", name, source), err)
+		}
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("Error reading commit %s: %v", hash, err)
+	}
+	what := fmt.Sprintf("Commit %s of %s", hash, source)
+	if commit.PGPSignature == "" {
+		if tagErr != nil {
+			return tagErr
+		}
+		return fmt.Errorf("%s isn't signed, refusing to use it since signatures are verified", what)
+	}
+	signer, err := commit.Verify(trustedKeys)
+	if err != nil {
+		return signatureError(what, err)
+	}
+	log.Printf("Commit %s is signed by %s", hash, identity(signer))
+	return nil
+}
+
+// signatureError explains why the signature of what was refused
+func signatureError(what string, err error) error {
+	if err == pgperrors.ErrUnknownIssuer {
+		return fmt.Errorf("%s is signed by a key that isn't trusted, refusing to use it", what)
+	}
+	return fmt.Errorf("%s has an invalid signature, refusing to use it: %v", what, err)
+}
+
+// identity describes the owner of a key for messages
+func identity(e *openpgp.Entity) string {
+	var names []string
+	for name := range e.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return e.PrimaryKey.KeyIdString()
+	}
+	return fmt.Sprintf("%s (%s)", names[0], e.PrimaryKey.KeyIdString())
+}
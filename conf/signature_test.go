@@ -0,0 +1,181 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// signingKey generates a small key and writes its public key to a file in dir
+func signingKey(t *testing.T, dir string, name string) (*openpgp.Entity, string) {
+	key, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	var public bytes.Buffer
+	if err := key.Serialize(&public); err != nil {
+		t.Fatalf("Error exporting key: %v", err)
+	}
+	path := filepath.Join(dir, name+".gpg")
+	if err := ioutil.WriteFile(path, public.Bytes(), 0644); err != nil {
+		t.Fatalf("Error writing key: %v", err)
+	}
+	return key, path
+}
+
+func TestPullVerifySignature(t *testing.T) {
+	origin, repo, _ := versionRepo(t)
+	defer removeRepo(t, origin)
+	keys, err := ioutil.TempDir("", "godot-keys")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(keys)
+	trusted, trustedPath := signingKey(t, keys, "trusted")
+	untrusted, _ := signingKey(t, keys, "untrusted")
+	settings := &Settings{TrustedKeys: []string{trustedPath}}
+	keyring, err := settings.Keyring()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Error opening worktree: %v", err)
+	}
+	author := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit := func(version string, key *openpgp.Entity) {
+		if err := ioutil.WriteFile(filepath.Join(origin.RepoDirectory, "version"), []byte(version), 0644); err != nil {
+			t.Fatalf("Error writing version: %v", err)
+		}
+		if _, err := wt.Add("version"); err != nil {
+			t.Fatalf("Error adding version: %v", err)
+		}
+		hash, err := wt.Commit(version, &git.CommitOptions{Author: author, SignKey: key})
+		if err != nil {
+			t.Fatalf("Error committing: %v", err)
+		}
+		if _, err := repo.CreateTag(version, hash, &git.CreateTagOptions{Tagger: author, Message: version, SignKey: trusted}); err != nil {
+			t.Fatalf("Error tagging: %v", err)
+		}
+	}
+	commit("unsigned", nil)
+	commit("untrusted", untrusted)
+	commit("trusted", trusted)
+
+	remote, err := url.Parse("file://" + origin.RepoDirectory)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pull := func(ref string) error {
+		dir, err := ioutil.TempDir("", "godot-pull")
+		if err != nil {
+			t.Fatalf("Error creating temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		r := &GitRepository{Remote: remote, RepoDirectory: dir, Ref: ref, TrustedKeys: keyring}
+		return r.Pull()
+	}
+	if err := pull(""); err != nil {
+		t.Errorf("Unexpected error pulling a trusted commit: %v", err)
+	}
+	// the tags are signed by the trusted key
+	if err := pull("unsigned"); err != nil {
+		t.Errorf("Unexpected error pulling a trusted tag: %v", err)
+	}
+
+	refs, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatalf("Error reading log: %v", err)
+	}
+	hashes := map[string]string{}
+	refs.ForEach(func(c *object.Commit) error {
+		hashes[c.Message] = c.Hash.String()
+		return nil
+	})
+	tests := map[string]string{
+		hashes["unsigned"]:  "isn't signed",
+		hashes["untrusted"]: "isn't trusted",
+	}
+	for ref, expected := range tests {
+		if err := pull(ref); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error saying it %s, got %v", ref, expected, err)
+		}
+	}
+}
+
+func TestVerifyDirectory(t *testing.T) {
+	origin, repo, _ := versionRepo(t)
+	defer removeRepo(t, origin)
+	keys, err := ioutil.TempDir("", "godot-keys")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(keys)
+	trusted, trustedPath := signingKey(t, keys, "trusted")
+	keyring, err := (&Settings{TrustedKeys: []string{trustedPath}}).Keyring()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Error opening worktree: %v", err)
+	}
+	author := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filepath.Join(origin.RepoDirectory, "version"), []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing version: %v", err)
+		}
+	}
+	commit := func(version string, key *openpgp.Entity) plumbing.Hash {
+		write(version)
+		if _, err := wt.Add("version"); err != nil {
+			t.Fatalf("Error adding version: %v", err)
+		}
+		hash, err := wt.Commit(version, &git.CommitOptions{Author: author, SignKey: key})
+		if err != nil {
+			t.Fatalf("Error committing: %v", err)
+		}
+		return hash
+	}
+
+	hash := commit("unsigned", nil)
+	if err := VerifyDirectory(origin.RepoDirectory, keyring); err == nil || !strings.Contains(err.Error(), "isn't signed") {
+		t.Errorf("Expected an unsigned HEAD to be refused, got %v", err)
+	}
+	if _, err := repo.CreateTag("v1", hash, &git.CreateTagOptions{Tagger: author, Message: "v1", SignKey: trusted}); err != nil {
+		t.Fatalf("Error tagging: %v", err)
+	}
+	if err := VerifyDirectory(origin.RepoDirectory, keyring); err != nil {
+		t.Errorf("Unexpected error with a signed tag of HEAD: %v", err)
+	}
+	commit("signed", trusted)
+	if err := VerifyDirectory(origin.RepoDirectory, keyring); err != nil {
+		t.Errorf("Unexpected error with a signed HEAD: %v", err)
+	}
+	write("changed")
+	if err := VerifyDirectory(origin.RepoDirectory, keyring); err == nil || !strings.Contains(err.Error(), "uncommitted") {
+		t.Errorf("Expected uncommitted changes to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Configuration formats understood by godot
+const (
+	FormatReadme = "readme"
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatTOML   = "toml"
+)
+
+// configFiles are the standalone configuration files godot looks for at the root
+// of a repository, in order of precedence. README.md is only used when none exist.
+var configFiles = []string{
+	"godot.yaml",
+	"godot.yml",
+	".godot.yaml",
+	".godot.yml",
+	"godot.json",
+	".godot.json",
+	"godot.toml",
+	".godot.toml",
+}
+
+// Source is a godot configuration document read from a repository
+type Source struct {
+	Path   string
+	Format string
+	Raw    string
+	// Lines maps each line of Raw to its line in Path, it is nil when they are the same
+	Lines []int
+}
+
+var lineNumberPattern = regexp.MustCompile(`\bline (\d+)`)
+
+// Line returns the line in Path of a line in Raw
+func (src *Source) Line(line int) int {
+	if src.Lines == nil || line < 1 || line > len(src.Lines) {
+		return line
+	}
+	return src.Lines[line-1]
+}
+
+// translateError rewrites the line numbers in a decoding error to lines in Path
+func (src *Source) translateError(err error) error {
+	if src.Lines == nil {
+		return fmt.Errorf("%s: %v", src.Path, err)
+	}
+	msg := lineNumberPattern.ReplaceAllStringFunc(err.Error(), func(match string) string {
+		line, _ := strconv.Atoi(strings.TrimPrefix(match, "line "))
+		return fmt.Sprintf("line %d", src.Line(line))
+	})
+	return fmt.Errorf("%s: %s", src.Path, msg)
+}
+
+// formatFromPath picks the configuration format from a file extension
+func formatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".md", ".markdown":
+		return FormatReadme, nil
+	}
+	return "", fmt.Errorf("Unknown configuration format for %s", path)
+}
+
+// readSource reads the configuration document at path, relative to the repository root
+func readSource(r Repository, path string) (*Source, error) {
+	format, err := formatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	fullPath, err := r.GetFilePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not exist: %v", path, err)
+	}
+	src := &Source{Path: path, Format: format}
+	if format == FormatReadme {
+		src.Raw, src.Lines, err = parseReadme(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Godot configuration in %s: %v", path, err)
+		}
+		return src, nil
+	}
+	contents, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	src.Raw = string(contents)
+	return src, nil
+}
+
+// FindConfig locates the godot configuration of a repository. An explicit name, such
+// as one passed with --config, is read as-is. Otherwise the standalone configuration
+// files are tried before falling back to README.md, and finding more than one source
+// is an error.
+func FindConfig(r Repository, name string) (*Source, error) {
+	if name != "" {
+		return readSource(r, name)
+	}
+
+	var found []string
+	for _, file := range configFiles {
+		if _, err := r.GetFilePath(file); err == nil {
+			found = append(found, file)
+		}
+	}
+	if readmePath, err := r.GetFilePath("README.md"); err == nil && readmeHasConfig(readmePath) {
+		found = append(found, "README.md")
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("No godot configuration found, add a godot.yaml or a `%s` section to README.md", confHeader)
+	case 1:
+		return readSource(r, found[0])
+	}
+	return nil, fmt.Errorf("Found conflicting godot configurations (%s), choose one with --config", strings.Join(found, ", "))
+}
+
+// yamlDocument returns the configuration document as YAML, with its lines mapped to
+// lines in Path. JSON is a subset of YAML and is returned as-is, TOML is converted.
+func (src *Source) yamlDocument() (*Source, error) {
+	if src.Format != FormatTOML {
+		return src, nil
+	}
+	raw, lines, err := tomlToYAML(src.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{Path: src.Path, Format: FormatYAML, Raw: raw, Lines: lines}, nil
+}
+
+// Decode unmarshals the configuration document into gdc
+func (src *Source) Decode(gdc *GoDotConfig) error {
+	doc, err := src.yamlDocument()
+	if err != nil {
+		return fmt.Errorf("Error parsing %s: %v", src.Path, err)
+	}
+	if err := yaml.Unmarshal([]byte(doc.Raw), gdc); err != nil {
+		return doc.translateError(err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pmalmgren/godot/dockerfile"
+)
+
+// scriptDirectory is where the scripts of script steps are copied in the image
+const scriptDirectory = "/opt/godot/scripts"
+
+// Step is a system-setup or user-setup step. A plain string is a Dockerfile line
+// and is kept in Raw, otherwise exactly one of Run, Script, Copy, Env and Workdir
+// is set.
+type Step struct {
+	Raw string `yaml:"-"`
+	// Run is a shell command
+	Run string `yaml:"run,omitempty"`
+	// Script is the path of a script in the repository to run
+	Script string `yaml:"script,omitempty"`
+	// Dir is the directory Run or Script runs in, it doesn't affect later steps
+	Dir string `yaml:"dir,omitempty"`
+	// Copy copies a file or directory of the repository into the image
+	Copy *CopyStep `yaml:"copy,omitempty"`
+	// Env sets environment variables for later steps and the container
+	Env map[string]string `yaml:"env,omitempty"`
+	// Workdir sets the working directory of later steps
+	Workdir string `yaml:"workdir,omitempty"`
+}
+
+// CopyStep copies Src, a path in the repository, to Dest in the image and
+// optionally changes its mode
+type CopyStep struct {
+	Src  string `yaml:"src"`
+	Dest string `yaml:"dest"`
+	Mode string `yaml:"mode,omitempty"`
+}
+
+// RawSteps turns Dockerfile lines into steps
+func RawSteps(lines ...string) []Step {
+	steps := make([]Step, len(lines))
+	for i, line := range lines {
+		steps[i] = Step{Raw: line}
+	}
+	return steps
+}
+
+// structuredStep has the fields of Step without its methods, to decode it
+type structuredStep Step
+
+// UnmarshalYAML reads a step from a string or a mapping
+func (s *Step) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err == nil {
+		*s = Step{Raw: raw}
+		return nil
+	}
+	var structured structuredStep
+	if err := unmarshal(&structured); err != nil {
+		return err
+	}
+	*s = Step(structured)
+	return s.Validate()
+}
+
+// MarshalYAML writes a Raw step as a string
+func (s Step) MarshalYAML() (interface{}, error) {
+	if s.Raw != "" {
+		return s.Raw, nil
+	}
+	return structuredStep(s), nil
+}
+
+// Validate checks that exactly one kind of step is set and that paths stay in
+// the repository
+func (s *Step) Validate() error {
+	var kinds []string
+	for kind, set := range map[string]bool{
+		"run":     s.Run != "",
+		"script":  s.Script != "",
+		"copy":    s.Copy != nil,
+		"env":     len(s.Env) > 0,
+		"workdir": s.Workdir != "",
+	} {
+		if set {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	if len(kinds) != 1 {
+		return fmt.Errorf("A setup step needs exactly one of run, script, copy, env or workdir, got %d (%s)", len(kinds), strings.Join(kinds, ", "))
+	}
+	if s.Dir != "" && s.Run == "" && s.Script == "" {
+		return fmt.Errorf("dir is only allowed with run or script")
+	}
+	if s.Script != "" {
+		if err := repositoryPath(s.Script); err != nil {
+			return fmt.Errorf("Invalid script: %v", err)
+		}
+	}
+	if s.Copy != nil {
+		if s.Copy.Src == "" || s.Copy.Dest == "" {
+			return fmt.Errorf("copy needs src and dest")
+		}
+		if err := repositoryPath(s.Copy.Src); err != nil {
+			return fmt.Errorf("Invalid copy src: %v", err)
+		}
+	}
+	return nil
+}
+
+// repositoryPath checks that p is a relative path that doesn't leave the repository
+func repositoryPath(p string) error {
+	clean := path.Clean(p)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%s must be a path inside the repository", p)
+	}
+	return nil
+}
+
+// ContextPath returns the path in the repository the step needs in the build context
+func (s *Step) ContextPath() string {
+	if s.Script != "" {
+		return path.Clean(s.Script)
+	}
+	if s.Copy != nil {
+		return path.Clean(s.Copy.Src)
+	}
+	return ""
+}
+
+// Instructions returns the Dockerfile instructions of the step. Copies made by
+// user-setup steps are owned by user.
+func (s *Step) Instructions(user string) []dockerfile.Instruction {
+	switch {
+	case s.Raw != "":
+		return []dockerfile.Instruction{dockerfile.Raw{Source: s.Raw}}
+	case s.Run != "":
+		return []dockerfile.Instruction{dockerfile.Run{Commands: s.inDir(runScript(s.Run))}}
+	case s.Script != "":
+		return []dockerfile.Instruction{dockerfile.Run{Commands: s.inDir(scriptPath(s.Script))}}
+	case s.Copy != nil:
+		copy := dockerfile.Copy{Sources: []string{path.Clean(s.Copy.Src)}, Dest: s.Copy.Dest, Chown: user}
+		if s.Copy.Mode == "" {
+			return []dockerfile.Instruction{copy}
+		}
+		// COPY --chmod needs BuildKit
+		target := s.Copy.Dest
+		if strings.HasSuffix(target, "/") {
+			target = path.Join(target, path.Base(s.Copy.Src))
+		}
+		return []dockerfile.Instruction{copy, dockerfile.Run{Commands: []string{"chmod -R " + s.Copy.Mode + " " + shellQuote(target)}}}
+	case len(s.Env) > 0:
+		names := make([]string, 0, len(s.Env))
+		for name := range s.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		vars := make([]dockerfile.KeyValue, len(names))
+		for i, name := range names {
+			vars[i] = dockerfile.KeyValue{Key: name, Value: s.Env[name]}
+		}
+		return []dockerfile.Instruction{dockerfile.Env{Vars: vars}}
+	case s.Workdir != "":
+		return []dockerfile.Instruction{dockerfile.Workdir{Path: s.Workdir}}
+	}
+	return nil
+}
+
+// runScript returns the command running the script of a run step. RUN turns
+// newlines into line continuations, so a script of several lines is passed to sh
+// line by line instead, stopping at the first failing command.
+func runScript(script string) string {
+	script = strings.TrimRight(script, "\n")
+	if !strings.Contains(script, "\n") {
+		return script
+	}
+	lines := strings.Split(script, "\n")
+	for i, line := range lines {
+		lines[i] = "'" + strings.Replace(line, "'", `'\''`, -1) + "'"
+	}
+	return "printf '%s\\n' " + strings.Join(lines, "\n") + " | sh -e"
+}
+
+// inDir runs command in the step's Dir, if it has one
+func (s *Step) inDir(command string) []string {
+	if s.Dir == "" {
+		return []string{command}
+	}
+	return []string{"cd " + shellQuote(s.Dir), command}
+}
+
+// scriptPath is where the script at p in the repository is copied in the image
+func scriptPath(p string) string {
+	return path.Join(scriptDirectory, path.Clean(p))
+}
+
+// shellQuote quotes s for the shell, leaving a leading ~ to be expanded
+func shellQuote(s string) string {
+	if s == "~" {
+		return s
+	}
+	if strings.HasPrefix(s, "~/") {
+		return "~/" + shellQuote(s[2:])
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
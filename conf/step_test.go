@@ -0,0 +1,134 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pmalmgren/godot/dockerfile"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestStepInstructions(t *testing.T) {
+	var gdc GoDotConfig
+	err := yaml.Unmarshal([]byte(`
+dotfile-directory: dotfiles
+system-setup:
+  - RUN ls
+  - run: make install
+    dir: /src
+  - script: scripts/setup.sh
+  - env: {GOPATH: /go, EDITOR: vim}
+user-setup:
+  - copy: {src: bin/tool, dest: bin/, mode: "0755"}
+  - workdir: projects
+`), &gdc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var system []string
+	for _, step := range gdc.SystemSetup {
+		for _, instruction := range step.Instructions("") {
+			system = append(system, instruction.String())
+		}
+	}
+	expected := []string{
+		"RUN ls",
+		"RUN cd '/src' && \\\n    make install",
+		"RUN /opt/godot/scripts/scripts/setup.sh",
+		"ENV EDITOR=vim GOPATH=/go",
+	}
+	if !reflect.DeepEqual(system, expected) {
+		t.Errorf("Expected %q, got %q", expected, system)
+	}
+
+	user := append(gdc.UserSetup[0].Instructions("$username"), gdc.UserSetup[1].Instructions("$username")...)
+	expectedUser := []dockerfile.Instruction{
+		dockerfile.Copy{Sources: []string{"bin/tool"}, Dest: "bin/", Chown: "$username"},
+		dockerfile.Run{Commands: []string{"chmod -R 0755 'bin/tool'"}},
+		dockerfile.Workdir{Path: "projects"},
+	}
+	if !reflect.DeepEqual(user, expectedUser) {
+		t.Errorf("Expected %v, got %v", expectedUser, user)
+	}
+
+	if expected := []string{"dotfiles", "scripts/setup.sh", "bin/tool"}; !reflect.DeepEqual(gdc.ContextPaths(), expected) {
+		t.Errorf("Expected context paths %v, got %v", expected, gdc.ContextPaths())
+	}
+
+	out, err := yaml.Marshal(gdc.SystemSetup[:2])
+	if err != nil || string(out) != "- RUN ls\n- run: make install\n  dir: /src\n" {
+		t.Errorf("Unexpected YAML %q (%v)", out, err)
+	}
+}
+
+func TestStepMultiLineRun(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("No shell to run the step")
+	}
+	var steps []Step
+	err = yaml.Unmarshal([]byte(`
+- run: |
+    echo one
+    echo 'two'
+    if [ -n "$HOME" ]; then
+      echo three
+    fi
+- run: |
+    false
+    echo unreachable
+`), &steps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// run the instruction like Docker does, joining continued lines
+	run := func(step Step) (string, error) {
+		instructions := step.Instructions("")
+		if len(instructions) != 1 {
+			t.Fatalf("Expected one instruction, got %v", instructions)
+		}
+		line := instructions[0].String()
+		if !strings.HasPrefix(line, "RUN ") || strings.HasSuffix(line, "\\") {
+			t.Fatalf("Unexpected instruction %q", line)
+		}
+		out, err := exec.Command(sh, "-c", strings.Replace(strings.TrimPrefix(line, "RUN "), "\\\n", "", -1)).CombinedOutput()
+		return string(out), err
+	}
+	if out, err := run(steps[0]); err != nil || out != "one\ntwo\nthree\n" {
+		t.Errorf("Expected each line to run, got %q (%v)", out, err)
+	}
+	if out, err := run(steps[1]); err == nil || out != "" {
+		t.Errorf("Expected the script to stop at the failing line, got %q (%v)", out, err)
+	}
+}
+
+func TestStepValidate(t *testing.T) {
+	tests := map[string]string{
+		"- {run: ls, workdir: /src}":            "exactly one",
+		"- {}":                                  "exactly one",
+		"- {env: {A: b}, dir: /src}":            "dir is only allowed",
+		"- {script: ../outside.sh}":             "inside the repository",
+		"- {copy: {src: /etc/passwd, dest: /}}": "inside the repository",
+		"- {copy: {src: bin}}":                  "needs src and dest",
+		"- {rum: ls}":                           "rum",
+	}
+	for doc, expected := range tests {
+		var steps []Step
+		err := yaml.UnmarshalStrict([]byte(doc), &steps)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", doc, expected, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pmalmgren/godot/link"
+)
+
+// ParseVars reads template variables given as key=value
+func ParseVars(assignments []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, assignment := range assignments {
+		eq := strings.Index(assignment, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("Invalid variable %q, use key=value", assignment)
+		}
+		vars[assignment[:eq]] = assignment[eq+1:]
+	}
+	return vars, nil
+}
+
+// TemplateData returns the values dotfile templates are rendered with: the
+// configured variables and the built-in username, profile and arch
+func (gdc *GoDotConfig) TemplateData() (map[string]string, error) {
+	data := map[string]string{
+		"username": gdc.Username,
+		"profile":  gdc.Profile,
+		"arch":     gdc.Arch,
+	}
+	for name, value := range gdc.Vars {
+		if _, ok := data[name]; ok {
+			return nil, fmt.Errorf("The template variable %s is built in and can't be set", name)
+		}
+		data[name] = value
+	}
+	return data, nil
+}
+
+// RenderTemplates renders the templates in the dotfile directory with the values
+// of TemplateData. The rendered files are keyed by the path of their template in
+// the repository, using forward slashes. Undefined variables are errors.
+func (gdc *GoDotConfig) RenderTemplates() (map[string][]byte, error) {
+	data, err := gdc.TemplateData()
+	if err != nil {
+		return nil, err
+	}
+	rendered := make(map[string][]byte)
+	err = gdc.walkDotfiles([]string{link.TemplateSuffix}, func(rel string, p string) error {
+		contents, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("Error reading template %s: %v", rel, err)
+		}
+		tmpl, err := template.New(rel).Option("missingkey=error").Parse(string(contents))
+		if err != nil {
+			return fmt.Errorf("Error parsing template: %v", err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return fmt.Errorf("Error rendering template: %v", err)
+		}
+		rendered[rel] = out.Bytes()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// walkDotfiles calls fn with the path in the repository, using forward slashes,
+// and the full path of each regular file in the dotfile directory ending in one of
+// suffixes. A missing dotfile directory has no files.
+func (gdc *GoDotConfig) walkDotfiles(suffixes []string, fn func(rel string, p string) error) error {
+	root := gdc.HostPath(gdc.DotfileDirectory)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		for _, suffix := range suffixes {
+			if !strings.HasSuffix(p, suffix) {
+				continue
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			return fn(path.Join(filepath.ToSlash(gdc.DotfileDirectory), filepath.ToSlash(rel)), p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// dotfilePath returns the path in the dotfile directory of a file made from the
+// file at rel in the repository, by removing its suffix
+func (gdc *GoDotConfig) dotfilePath(rel string, suffix string) string {
+	prefix := path.Clean(filepath.ToSlash(gdc.DotfileDirectory)) + "/"
+	if prefix == "./" {
+		prefix = ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(rel, prefix), suffix)
+}
+
+// WriteTemplates renders the templates in the dotfile directory into dir, at their
+// path in the dotfile directory without the template suffix. Anything else in dir
+// is removed, and dir is only accessible to the user.
+func (gdc *GoDotConfig) WriteTemplates(dir string) error {
+	rendered, err := gdc.RenderTemplates()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("Error removing %s: %v", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Error creating %s: %v", dir, err)
+	}
+	for name, contents := range rendered {
+		info, err := os.Stat(gdc.HostPath(name))
+		if err != nil {
+			return fmt.Errorf("Error reading template %s: %v", name, err)
+		}
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(gdc.dotfilePath(name, link.TemplateSuffix))), contents, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes a file, creating its directory
+func writeFile(p string, contents []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %v", p, err)
+	}
+	if err := ioutil.WriteFile(p, contents, perm); err != nil {
+		return fmt.Errorf("Error writing %s: %v", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTemplateRepo creates a repository with a configuration and a template
+func writeTemplateRepo(t *testing.T, template string) *FilesystemRepository {
+	r := writeRepo(t, map[string]string{
+		"godot.yaml": `username: test-user
+image-tag: test-dev-env
+dotfile-directory: dotfiles
+entrypoint: zsh
+vars:
+  email: me@home.example.com
+  proxy: ""
+profiles:
+  work:
+    vars:
+      email: me@work.example.com
+`,
+	})
+	dir := filepath.Join(r.RepoDirectory, "dotfiles", "git")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Error creating dotfiles directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitconfig.tmpl"), []byte(template), 0600); err != nil {
+		t.Fatalf("Error writing template: %v", err)
+	}
+	return r
+}
+
+func TestRenderTemplates(t *testing.T) {
+	r := writeTemplateRepo(t, "{{.username}} {{.profile}} {{.arch}} {{.email}}{{if .proxy}} {{.proxy}}{{end}}")
+	defer removeRepo(t, r)
+
+	tests := []struct {
+		opts     LoadOptions
+		expected string
+	}{
+		{LoadOptions{Arch: "arm64"}, "test-user  arm64 me@home.example.com"},
+		{LoadOptions{Arch: "amd64", Profile: "work"}, "test-user work amd64 me@work.example.com"},
+		{LoadOptions{Arch: "amd64", Profile: "work", Vars: map[string]string{"proxy": "http://proxy:3128"}}, "test-user work amd64 me@work.example.com http://proxy:3128"},
+	}
+	for _, test := range tests {
+		gdc, err := ConfigFromRepository(r, test.opts)
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", test.opts, err)
+		}
+		rendered, err := gdc.RenderTemplates()
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.opts, err)
+			continue
+		}
+		expected := map[string][]byte{"dotfiles/git/.gitconfig.tmpl": []byte(test.expected)}
+		if !reflect.DeepEqual(rendered, expected) {
+			t.Errorf("%+v: expected %q, got %q", test.opts, expected, rendered)
+		}
+	}
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := filepath.Join(r.RepoDirectory, "rendered")
+	if err := gdc.WriteTemplates(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(out, "git", ".gitconfig"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the rendered file with the template's mode: %v", err)
+	}
+}
+
+func TestRenderTemplatesErrors(t *testing.T) {
+	r := writeTemplateRepo(t, "{{.email}} {{.signingkey}}")
+	defer removeRepo(t, r)
+
+	gdc, err := ConfigFromRepository(r, LoadOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := gdc.RenderTemplates(); err == nil || !strings.Contains(err.Error(), "signingkey") || !strings.Contains(err.Error(), ".gitconfig.tmpl") {
+		t.Errorf("Expected an error naming the undefined variable and template, got %v", err)
+	}
+
+	gdc, err = ConfigFromRepository(r, LoadOptions{Vars: map[string]string{"signingkey": "ABC", "username": "other"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := gdc.RenderTemplates(); err == nil || !strings.Contains(err.Error(), "built in") {
+		t.Errorf("Expected an error setting a built-in variable, got %v", err)
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]string{"email=me@example.com", "url=http://x/?a=b", "empty="})
+	expected := map[string]string{"email": "me@example.com", "url": "http://x/?a=b", "empty": ""}
+	if err != nil || !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, vars, err)
+	}
+	for _, invalid := range []string{"email", "=value"} {
+		if _, err := ParseVars([]string{invalid}); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// decodeTOML parses a TOML document into a generic map
+func decodeTOML(raw string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	if _, err := toml.Decode(raw, &doc); err != nil {
+		if parseErr, ok := err.(toml.ParseError); ok {
+			return nil, fmt.Errorf("line %d: %s", parseErr.Position.Line, parseErr.Message)
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// tomlToYAML converts a TOML document to YAML, so every format shares the yaml
+// struct tags. lines maps each line of the YAML document to the line of the TOML
+// document setting the top-level key it belongs to.
+func tomlToYAML(raw string) (string, []int, error) {
+	doc, err := decodeTOML(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	keys := tomlKeyLines(raw)
+	yamlKeys, _ := yamlKeyLines(string(out))
+	names := make(map[int]string, len(yamlKeys))
+	for name, line := range yamlKeys {
+		names[line] = name
+	}
+	lines := make([]int, strings.Count(string(out), "\n"))
+	line := 0
+	for i := range lines {
+		if name, ok := names[i+1]; ok {
+			line = keys[name]
+		}
+		lines[i] = line
+	}
+	return string(out), lines, nil
+}
+
+// tomlKeyLines finds the first line of each top-level key in a TOML document, set
+// by a key/value pair at the top or a table header
+func tomlKeyLines(raw string) map[string]int {
+	keys := make(map[string]int)
+	inTable := false
+	var multiline string
+	for i, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if multiline != "" {
+			if strings.Count(trimmed, multiline)%2 == 1 {
+				multiline = ""
+			}
+			continue
+		}
+		for _, quote := range []string{`"""`, "'''"} {
+			if strings.Count(trimmed, quote)%2 == 1 {
+				multiline = quote
+			}
+		}
+		var key string
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			inTable = true
+			key = strings.TrimLeft(trimmed, "[ \t")
+		case !inTable && trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+			key = trimmed
+		default:
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		if quote := key[0]; quote == '"' || quote == '\'' {
+			if end := strings.IndexByte(key[1:], quote); end >= 0 {
+				key = key[1 : end+1]
+			}
+		} else if end := strings.IndexAny(key, ".=] \t"); end > 0 {
+			key = key[:end]
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = i + 1
+		}
+	}
+	return keys
+}
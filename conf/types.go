@@ -8,29 +8,98 @@
 
 package conf
 
-import "net/url"
+import (
+	"github.com/pmalmgren/godot/link"
+	"github.com/pmalmgren/godot/secret"
+)
 
 const (
-	confHeader        = "## godot configuration"
-	confBoundaryToken = "```"
+	confHeader = "## godot configuration"
 )
 
 // GoDotConfig contains the relevant configuration to pass to the Dockerfile template
 type GoDotConfig struct {
-	Username           string   `yaml:"username"`
-	DotfileDirectory   string   `yaml:"dotfile-directory"`
-	Packages           []string `yaml:"packages"`
-	SystemSetup        []string `yaml:"system-setup"`
-	UserSetup          []string `yaml:"user-setup"`
-	EntryPoint         string   `yaml:"entrypoint"`
-	ImageTag           string   `yaml:"image-tag"`
-	OutputDirectory    string
-	RepoDirectory      string
-	DockerfileRendered string
+	Extends          string             `yaml:"extends,omitempty"`
+	BaseImage        string             `yaml:"base-image,omitempty"`
+	Distro           string             `yaml:"distro,omitempty"`
+	Username         string             `yaml:"username,omitempty"`
+	UID              *int               `yaml:"uid,omitempty"`
+	GID              *int               `yaml:"gid,omitempty"`
+	DotfileDirectory string             `yaml:"dotfile-directory,omitempty"`
+	Packages         []string           `yaml:"packages,omitempty"`
+	RemovePackages   []string           `yaml:"remove-packages,omitempty"`
+	SystemSetup      []Step             `yaml:"system-setup,omitempty"`
+	UserSetup        []Step             `yaml:"user-setup,omitempty"`
+	EntryPoint       string             `yaml:"entrypoint,omitempty"`
+	ImageTag         string             `yaml:"image-tag,omitempty"`
+	Profiles         map[string]Profile `yaml:"profiles,omitempty"`
+	// Link configures how the dotfiles are linked into the home directory
+	Link link.Options `yaml:"link,omitempty"`
+	// Vars are the variables of dotfile templates
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// Secrets configures the encrypted files of the dotfile directory
+	Secrets secret.Options `yaml:"secrets,omitempty"`
+	// Volumes, Ports, Workdir and Env configure containers started with godot run
+	Volumes []string          `yaml:"volumes,omitempty"`
+	Ports   []string          `yaml:"ports,omitempty"`
+	Workdir string            `yaml:"workdir,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	// Profile is the name of the profile applied with WithProfile
+	Profile string `yaml:"-"`
+	// Arch is the architecture the image is built for
+	Arch               string `yaml:"-"`
+	OutputDirectory    string `yaml:"-"`
+	RepoDirectory      string `yaml:"-"`
+	DockerfileRendered string `yaml:"-"`
+	// Origins maps the paths inherited from repositories extended by URL to the
+	// directories of their clones, see FilePath
+	Origins map[string]string `yaml:"-"`
+	// release releases the clones in Origins, see Close
+	release []func()
+}
+
+// Profile is a named variant of a configuration. Its scalar fields override the
+// base configuration, its lists are appended to the base lists and RemovePackages
+// drops packages from the result.
+type Profile struct {
+	BaseImage        string   `yaml:"base-image,omitempty"`
+	Distro           string   `yaml:"distro,omitempty"`
+	DotfileDirectory string   `yaml:"dotfile-directory,omitempty"`
+	Packages         []string `yaml:"packages,omitempty"`
+	RemovePackages   []string `yaml:"remove-packages,omitempty"`
+	SystemSetup      []Step   `yaml:"system-setup,omitempty"`
+	UserSetup        []Step   `yaml:"user-setup,omitempty"`
+	EntryPoint       string   `yaml:"entrypoint,omitempty"`
+	ImageTag         string   `yaml:"image-tag,omitempty"`
+	// Vars override the template variables of the base configuration
+	Vars map[string]string `yaml:"vars,omitempty"`
+}
+
+// LoadOptions control how a configuration is read from a repository
+type LoadOptions struct {
+	// ConfigName is the configuration file to use, see FindConfig
+	ConfigName string
+	// Profile is the name of the profile to apply, if any
+	Profile string
+	// Vars override the template variables of the configuration
+	Vars map[string]string
+	// Arch is the architecture the image is built for, godot's own by default
+	Arch string
+	// TrustedKeys is an armored keyring the repositories cloned for extends must
+	// be signed by, signatures aren't checked if it's empty
+	TrustedKeys string
 }
 
-// Repository encapsulates functionality around access to files from a Git repository
-type Repository struct {
-	RepoDirectory string
-	Remote        *url.URL
+// Repository is a dotfiles repository on disk that configuration and dotfiles are read from
+type Repository interface {
+	// Directory returns the directory holding the repository's files
+	Directory() string
+	// GetFilePath returns the full path of a file or directory in the repository,
+	// or an error if it doesn't exist
+	GetFilePath(path string) (string, error)
+	// Head returns the SHA of the checked out commit, or an empty string when the
+	// files aren't from a Git repository
+	Head() (string, error)
+	// Source returns where the repository comes from, without credentials
+	Source() string
 }
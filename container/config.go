@@ -0,0 +1,132 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+// Package container runs the built environment in a Docker container.
+package container
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pmalmgren/godot/conf"
+)
+
+// DefaultWorkdir is where the project directory is mounted when workdir isn't configured
+const DefaultWorkdir = "/workspace"
+
+// Spec builds the configuration of a container running image from the volumes,
+// ports, workdir and env of gdc. projectDir is mounted at the workdir unless it is
+// empty, and tty allocates a terminal and keeps stdin open.
+func Spec(gdc *conf.GoDotConfig, image string, projectDir string, tty bool) (*containertypes.Config, *containertypes.HostConfig, error) {
+	config := &containertypes.Config{
+		Image:        image,
+		Tty:          tty,
+		OpenStdin:    tty,
+		StdinOnce:    tty,
+		AttachStdin:  tty,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   gdc.Workdir,
+		Env:          environment(gdc.Env),
+	}
+	hostConfig := &containertypes.HostConfig{AutoRemove: true}
+
+	if projectDir != "" {
+		if config.WorkingDir == "" {
+			config.WorkingDir = DefaultWorkdir
+		}
+		dir, err := filepath.Abs(projectDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error finding project directory: %v", err)
+		}
+		hostConfig.Binds = append(hostConfig.Binds, dir+":"+config.WorkingDir)
+	}
+
+	for _, volume := range gdc.Volumes {
+		bind, err := parseVolume(volume)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !strings.Contains(bind, ":") {
+			// a lone container path is an anonymous volume
+			if config.Volumes == nil {
+				config.Volumes = make(map[string]struct{})
+			}
+			config.Volumes[bind] = struct{}{}
+			continue
+		}
+		hostConfig.Binds = append(hostConfig.Binds, bind)
+	}
+
+	exposed, bindings, err := nat.ParsePortSpecs(gdc.Ports)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing ports: %v", err)
+	}
+	config.ExposedPorts = exposed
+	hostConfig.PortBindings = bindings
+	return config, hostConfig, nil
+}
+
+// SecretBinds mounts the secrets decrypted into dir read-only over their
+// placeholders in the dotfile directory of the image. names are relative to dir
+// and the dotfile directory, using forward slashes.
+func SecretBinds(gdc *conf.GoDotConfig, dir string, names []string) []string {
+	dotfiles := path.Join("/home", gdc.Username, "dotfiles")
+	binds := make([]string, len(names))
+	for i, name := range names {
+		binds[i] = filepath.Join(dir, filepath.FromSlash(name)) + ":" + path.Join(dotfiles, name) + ":ro"
+	}
+	sort.Strings(binds)
+	return binds
+}
+
+// parseVolume checks a `host:container[:mode]` volume. Host paths starting with ~
+// are expanded and relative host paths made absolute, named volumes are kept as is.
+func parseVolume(volume string) (string, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return "", fmt.Errorf("Invalid volume %q, expected host:container[:mode]", volume)
+	}
+	if len(parts) == 1 {
+		return volume, nil
+	}
+	host := parts[0]
+	if strings.HasPrefix(host, "~") {
+		expanded, err := homedir.Expand(host)
+		if err != nil {
+			return "", fmt.Errorf("Error expanding volume %q: %v", volume, err)
+		}
+		host = expanded
+	}
+	if strings.HasPrefix(host, ".") {
+		abs, err := filepath.Abs(host)
+		if err != nil {
+			return "", fmt.Errorf("Error expanding volume %q: %v", volume, err)
+		}
+		host = abs
+	}
+	parts[0] = host
+	return strings.Join(parts, ":"), nil
+}
+
+// environment turns env into sorted KEY=value pairs
+func environment(env map[string]string) []string {
+	var pairs []string
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,107 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pmalmgren/godot/conf"
+)
+
+func TestSpec(t *testing.T) {
+	gdc := &conf.GoDotConfig{
+		Volumes: []string{"~/.ssh:/home/me/.ssh:ro", "./data:/data", "cache:/cache", "/scratch"},
+		Ports:   []string{"8080:80", "127.0.0.1:2222:22/tcp"},
+		Env:     map[string]string{"EDITOR": "vim", "A": "b"},
+	}
+	config, hostConfig, err := Spec(gdc, "dev-env", "project", true)
+	if err != nil {
+		t.Fatalf("Error creating container spec: %v", err)
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatalf("Error finding home directory: %v", err)
+	}
+	project, _ := filepath.Abs("project")
+	data, _ := filepath.Abs("data")
+
+	if config.Image != "dev-env" || !config.Tty || !config.OpenStdin {
+		t.Errorf("Expected a TTY container of dev-env, got %+v", config)
+	}
+	if config.WorkingDir != DefaultWorkdir {
+		t.Errorf("Expected workdir %s, got %s", DefaultWorkdir, config.WorkingDir)
+	}
+	if expected := []string{"A=b", "EDITOR=vim"}; !reflect.DeepEqual(config.Env, expected) {
+		t.Errorf("Expected env %v, got %v", expected, config.Env)
+	}
+	binds := []string{
+		project + ":" + DefaultWorkdir,
+		filepath.Join(home, ".ssh") + ":/home/me/.ssh:ro",
+		data + ":/data",
+		"cache:/cache",
+	}
+	if !reflect.DeepEqual(hostConfig.Binds, binds) {
+		t.Errorf("Expected binds %v, got %v", binds, hostConfig.Binds)
+	}
+	if _, ok := config.Volumes["/scratch"]; !ok || len(config.Volumes) != 1 {
+		t.Errorf("Expected an anonymous volume /scratch, got %v", config.Volumes)
+	}
+	if !hostConfig.AutoRemove {
+		t.Errorf("Expected the container to be removed when it exits")
+	}
+	ssh := hostConfig.PortBindings[nat.Port("22/tcp")]
+	if len(ssh) != 1 || ssh[0].HostIP != "127.0.0.1" || ssh[0].HostPort != "2222" {
+		t.Errorf("Expected port 22 bound to 127.0.0.1:2222, got %v", ssh)
+	}
+	if _, ok := config.ExposedPorts[nat.Port("80/tcp")]; !ok {
+		t.Errorf("Expected port 80 to be exposed, got %v", config.ExposedPorts)
+	}
+}
+
+func TestSecretBinds(t *testing.T) {
+	gdc := &conf.GoDotConfig{Username: "test-user"}
+	binds := SecretBinds(gdc, "/run/secrets", []string{"ssh/.ssh/id_ed25519", "net/.netrc"})
+	expected := []string{
+		"/run/secrets/net/.netrc:/home/test-user/dotfiles/net/.netrc:ro",
+		"/run/secrets/ssh/.ssh/id_ed25519:/home/test-user/dotfiles/ssh/.ssh/id_ed25519:ro",
+	}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Errorf("Expected %v, got %v", expected, binds)
+	}
+}
+
+func TestSpecWithoutProject(t *testing.T) {
+	config, hostConfig, err := Spec(&conf.GoDotConfig{}, "dev-env", "", false)
+	if err != nil {
+		t.Fatalf("Error creating container spec: %v", err)
+	}
+	if config.WorkingDir != "" || len(hostConfig.Binds) != 0 {
+		t.Errorf("Expected no project mount, got workdir %q and binds %v", config.WorkingDir, hostConfig.Binds)
+	}
+	if config.Tty || config.OpenStdin {
+		t.Errorf("Expected a container without a TTY, got %+v", config)
+	}
+}
+
+func TestSpecInvalid(t *testing.T) {
+	for _, gdc := range []*conf.GoDotConfig{
+		{Volumes: []string{"a:b:c:d"}},
+		{Volumes: []string{":/data"}},
+		{Ports: []string{"80:http"}},
+	} {
+		if _, _, err := Spec(gdc, "dev-env", "", false); err == nil {
+			t.Errorf("Expected an error for %+v", gdc)
+		}
+	}
+}
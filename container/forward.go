@@ -0,0 +1,158 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/mitchellh/go-homedir"
+	sshagent "github.com/xanzy/ssh-agent"
+	gitconfig "gopkg.in/src-d/go-git.v4/plumbing/format/config"
+)
+
+const (
+	// agentSocketPath is where the host's SSH agent socket is mounted
+	agentSocketPath = "/run/godot/ssh-agent.sock"
+	// credentialsPath is where the host's git credentials are mounted
+	credentialsPath = "/run/godot/git-credentials"
+	// dockerDesktopAgent is the socket Docker Desktop provides for the host's SSH
+	// agent, macOS sockets can't be mounted into containers
+	dockerDesktopAgent = "/run/host-services/ssh-auth.sock"
+)
+
+// forwardedEnv are the environment variables Forward sets
+var forwardedEnv = map[string]bool{
+	"SSH_AUTH_SOCK":       true,
+	"GIT_AUTHOR_NAME":     true,
+	"GIT_COMMITTER_NAME":  true,
+	"GIT_AUTHOR_EMAIL":    true,
+	"GIT_COMMITTER_EMAIL": true,
+	"GIT_CONFIG_COUNT":    true,
+	"GIT_CONFIG_KEY_0":    true,
+	"GIT_CONFIG_VALUE_0":  true,
+}
+
+// credentialHelper is a git credential helper that only reads the mounted
+// credentials, so git inside the container can't store or erase any
+var credentialHelper = fmt.Sprintf(`!f() { test "$1" != get || git credential-store --file=%s get; }; f`, credentialsPath)
+
+// Forward is what is forwarded from the host into a container when it starts.
+// Everything is passed as mounts and environment variables of the container, so
+// none of it ends up in image layers.
+type Forward struct {
+	// SSHAuthSock is the host's SSH agent socket
+	SSHAuthSock string
+	// GitName and GitEmail are the host's git identity
+	GitName  string
+	GitEmail string
+	// GitCredentials is a git-credential-store file, mounted read-only
+	GitCredentials string
+}
+
+// HostForward finds the SSH agent and git identity of the host. The git
+// credentials in ~/.git-credentials are only forwarded when credentials is set.
+func HostForward(credentials bool) (Forward, error) {
+	f := Forward{SSHAuthSock: agentSocket()}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return f, fmt.Errorf("Error finding home directory: %v", err)
+	}
+	f.GitName, f.GitEmail, err = gitIdentity(home)
+	if err != nil {
+		return f, err
+	}
+
+	if credentials {
+		path := filepath.Join(home, ".git-credentials")
+		if _, err := os.Stat(path); err != nil {
+			return f, fmt.Errorf("Error reading git credentials: %v", err)
+		}
+		f.GitCredentials = path
+	}
+	return f, nil
+}
+
+// agentSocket returns the host's SSH agent socket, or an empty string when there
+// is no agent that can be forwarded
+func agentSocket() string {
+	if runtime.GOOS == "windows" || !sshagent.Available() {
+		return ""
+	}
+	_, conn, err := sshagent.New()
+	if err != nil {
+		log.Printf("Warning: not forwarding the SSH agent: %v", err)
+		return ""
+	}
+	conn.Close()
+	if runtime.GOOS == "darwin" {
+		return dockerDesktopAgent
+	}
+	return os.Getenv("SSH_AUTH_SOCK")
+}
+
+// gitIdentity reads user.name and user.email from the global git configuration
+// files, in the order git reads them
+func gitIdentity(home string) (string, string, error) {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	var name, email string
+	for _, path := range []string{filepath.Join(xdg, "git", "config"), filepath.Join(home, ".gitconfig")} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("Error reading %s: %v", path, err)
+		}
+		cfg := gitconfig.New()
+		err = gitconfig.NewDecoder(f).Decode(cfg)
+		f.Close()
+		if err != nil {
+			return "", "", fmt.Errorf("Error parsing %s: %v", path, err)
+		}
+		if v := cfg.Section("user").Option("name"); v != "" {
+			name = v
+		}
+		if v := cfg.Section("user").Option("email"); v != "" {
+			email = v
+		}
+	}
+	return name, email, nil
+}
+
+// Apply adds the mounts and environment variables forwarding f to a container
+func (f Forward) Apply(config *containertypes.Config, hostConfig *containertypes.HostConfig) {
+	if f.SSHAuthSock != "" {
+		hostConfig.Binds = append(hostConfig.Binds, f.SSHAuthSock+":"+agentSocketPath)
+		config.Env = append(config.Env, "SSH_AUTH_SOCK="+agentSocketPath)
+	}
+	if f.GitName != "" {
+		config.Env = append(config.Env, "GIT_AUTHOR_NAME="+f.GitName, "GIT_COMMITTER_NAME="+f.GitName)
+	}
+	if f.GitEmail != "" {
+		config.Env = append(config.Env, "GIT_AUTHOR_EMAIL="+f.GitEmail, "GIT_COMMITTER_EMAIL="+f.GitEmail)
+	}
+	if f.GitCredentials != "" {
+		hostConfig.Binds = append(hostConfig.Binds, f.GitCredentials+":"+credentialsPath+":ro")
+		config.Env = append(config.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0="+credentialHelper,
+		)
+	}
+}
@@ -0,0 +1,85 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+)
+
+func TestForwardApply(t *testing.T) {
+	f := Forward{
+		SSHAuthSock:    "/tmp/ssh-agent.sock",
+		GitName:        "Jane Doe",
+		GitEmail:       "jane@example.com",
+		GitCredentials: "/home/jane/.git-credentials",
+	}
+	config := &containertypes.Config{Env: []string{"EDITOR=vim"}}
+	hostConfig := &containertypes.HostConfig{}
+	f.Apply(config, hostConfig)
+
+	binds := []string{
+		"/tmp/ssh-agent.sock:" + agentSocketPath,
+		"/home/jane/.git-credentials:" + credentialsPath + ":ro",
+	}
+	if !reflect.DeepEqual(hostConfig.Binds, binds) {
+		t.Errorf("Expected binds %v, got %v", binds, hostConfig.Binds)
+	}
+	env := strings.Join(config.Env, "\n")
+	for _, e := range []string{"EDITOR=vim", "SSH_AUTH_SOCK=" + agentSocketPath, "GIT_AUTHOR_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com", "GIT_CONFIG_KEY_0=credential.helper"} {
+		if !strings.Contains(env, e) {
+			t.Errorf("Expected env to contain %q, got %v", e, config.Env)
+		}
+	}
+
+	config, hostConfig = &containertypes.Config{}, &containertypes.HostConfig{}
+	Forward{}.Apply(config, hostConfig)
+	if len(config.Env) != 0 || len(hostConfig.Binds) != 0 {
+		t.Errorf("Expected nothing to be forwarded, got env %v and binds %v", config.Env, hostConfig.Binds)
+	}
+}
+
+func TestGitIdentity(t *testing.T) {
+	home, err := ioutil.TempDir("", "godot-home")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(home)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	files := map[string]string{
+		"xdg/git/config": "[user]\n\tname = XDG Name\n\temail = xdg@example.com\n",
+		".gitconfig":     "[core]\n\teditor = vim\n[user]\n\tname = Jane Doe\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(home, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+
+	name, email, err := gitIdentity(home)
+	if err != nil {
+		t.Fatalf("Error reading git identity: %v", err)
+	}
+	if name != "Jane Doe" || email != "xdg@example.com" {
+		t.Errorf("Expected ~/.gitconfig to override the XDG config, got %q <%s>", name, email)
+	}
+}
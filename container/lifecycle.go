@@ -0,0 +1,277 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/pmalmgren/godot/conf"
+)
+
+// Labels of the persistent containers started by godot up
+const (
+	RepositoryLabel = "com.github.pmalmgren.godot.repository"
+	CommitLabel     = "com.github.pmalmgren.godot.commit"
+	ConfigLabel     = "com.github.pmalmgren.godot.config"
+	ProfileLabel    = "com.github.pmalmgren.godot.profile"
+	// SpecLabel holds a hash of the container's mounts, ports and environment
+	SpecLabel = "com.github.pmalmgren.godot.spec"
+	// SessionLabel holds a hash of the project directory and the forwards the
+	// container was started with, which may differ between terminals
+	SessionLabel = "com.github.pmalmgren.godot.session"
+)
+
+// lifecycleAPI is the part of the Docker client used to manage persistent containers
+type lifecycleAPI interface {
+	containerAPI
+	ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerStop(ctx context.Context, container string, timeout *time.Duration) error
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+}
+
+// invalidNameChars are the characters Docker doesn't allow in container names
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Name returns the name of the persistent container of gdc, derived from its image
+// tag and profile, so there is one container per configuration and profile
+func Name(gdc *conf.GoDotConfig) string {
+	name := "godot-" + gdc.ImageTag
+	if gdc.Profile != "" {
+		name += "-" + gdc.Profile
+	}
+	return invalidNameChars.ReplaceAllString(name, "-")
+}
+
+// HomeVolume returns the name of the volume holding the home directory of the container name
+func HomeVolume(name string) string {
+	return name + "-home"
+}
+
+// UpSpec builds the configuration of the persistent container of gdc. Unlike Spec it
+// isn't removed when it stops, it carries labels and the user's home directory is a
+// named volume, so it survives the container being recreated from a rebuilt image.
+func UpSpec(gdc *conf.GoDotConfig, image string, projectDir string, labels map[string]string) (*containertypes.Config, *containertypes.HostConfig, error) {
+	config, hostConfig, err := Spec(gdc, image, projectDir, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the entrypoint waits on an open stdin, so the container keeps running
+	// without anything attached
+	config.AttachStdin = false
+	config.StdinOnce = false
+	config.Labels = labels
+	hostConfig.AutoRemove = false
+	home := path.Join("/home", gdc.Username)
+	hostConfig.Binds = append(hostConfig.Binds, HomeVolume(Name(gdc))+":"+home)
+	return config, hostConfig, nil
+}
+
+// Up makes sure the container name is running image imageID. A stopped container is
+// started, and a stopped one created from an older image or with other mounts,
+// ports or environment is recreated. A running container may have other terminals
+// attached, so it's only recreated when recreate is set, otherwise it's used as it
+// is with a warning. It returns the container's ID.
+func Up(cli lifecycleAPI, name string, imageID string, config *containertypes.Config, hostConfig *containertypes.HostConfig, recreate bool) (string, error) {
+	ctx := context.Background()
+	spec, session, err := specHash(config, hostConfig)
+	if err != nil {
+		return "", err
+	}
+	labels := map[string]string{SpecLabel: spec, SessionLabel: session}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	config.Labels = labels
+
+	existing, err := cli.ContainerInspect(ctx, name)
+	if client.IsErrNotFound(err) {
+		return create(cli, name, config, hostConfig)
+	} else if err != nil {
+		return "", fmt.Errorf("Error inspecting container %s: %v", name, err)
+	}
+	running := existing.State != nil && existing.State.Running
+	outdated := existing.Image != imageID || existing.Config == nil || existing.Config.Labels[SpecLabel] != spec
+	switch {
+	case recreate || (outdated && !running):
+		log.Printf("Recreating %s with the new image and configuration", name)
+		if err := cli.ContainerRemove(ctx, existing.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			return "", fmt.Errorf("Error removing container %s: %v", name, err)
+		}
+		return create(cli, name, config, hostConfig)
+	case outdated:
+		log.Printf("Warning: %s is running an older image or configuration, use --recreate to replace it, which stops it in other terminals", name)
+	case running && existing.Config.Labels[SessionLabel] != session:
+		log.Printf("Warning: %s was started from another project directory or with other forwards, which it keeps, use --recreate to replace it", name)
+	case !running:
+		if err := cli.ContainerStart(ctx, existing.ID, types.ContainerStartOptions{}); err != nil {
+			return "", fmt.Errorf("Error starting container %s: %v", name, err)
+		}
+	}
+	return existing.ID, nil
+}
+
+// create creates and starts the container name
+func create(cli lifecycleAPI, name string, config *containertypes.Config, hostConfig *containertypes.HostConfig) (string, error) {
+	ctx := context.Background()
+	created, err := cli.ContainerCreate(ctx, config, hostConfig, nil, name)
+	if err != nil {
+		return "", fmt.Errorf("Error creating container %s: %v", name, err)
+	}
+	for _, warning := range created.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return "", fmt.Errorf("Error starting container %s: %v", name, err)
+	}
+	return created.ID, nil
+}
+
+// specHash hashes the settings of a container that can only be set when it is
+// created. The spec hash covers the configured ones, the session hash the project
+// directory and forwards, which depend on where godot runs.
+func specHash(config *containertypes.Config, hostConfig *containertypes.HostConfig) (string, string, error) {
+	var env, sessionEnv, binds, sessionBinds []string
+	for _, e := range config.Env {
+		if forwardedEnv[strings.SplitN(e, "=", 2)[0]] {
+			sessionEnv = append(sessionEnv, e)
+		} else {
+			env = append(env, e)
+		}
+	}
+	for _, bind := range hostConfig.Binds {
+		if target := bindTarget(bind); target == config.WorkingDir || target == agentSocketPath || target == credentialsPath {
+			sessionBinds = append(sessionBinds, bind)
+		} else {
+			binds = append(binds, bind)
+		}
+	}
+	spec, err := hash(env, config.Volumes, config.ExposedPorts, binds, hostConfig.PortBindings)
+	if err != nil {
+		return "", "", err
+	}
+	// the working directory is where the project is mounted, if it is
+	session, err := hash(sessionEnv, config.WorkingDir, sessionBinds)
+	if err != nil {
+		return "", "", err
+	}
+	return spec, session, nil
+}
+
+// bindTarget returns the container path of a host:container[:mode] bind
+func bindTarget(bind string) string {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 {
+		return bind
+	}
+	return parts[1]
+}
+
+// hash hashes the JSON encoding of values
+func hash(values ...interface{}) (string, error) {
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("Error hashing container configuration: %v", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Exec runs cmd in the running container id with streams attached, allocating a
+// TTY when tty is set. It returns the command's exit code.
+func Exec(cli lifecycleAPI, id string, cmd []string, tty bool, streams Streams) (int, error) {
+	ctx := context.Background()
+	created, err := cli.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Tty:          tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error creating exec: %v", err)
+	}
+	resp, err := cli.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: tty})
+	if err != nil {
+		return 0, fmt.Errorf("Error attaching to exec: %v", err)
+	}
+	defer resp.Close()
+
+	terminal, restore, err := rawTerminal(streams, tty)
+	if err != nil {
+		return 0, err
+	}
+	defer restore()
+	outputDone := stream(resp, tty, true, streams)
+	if terminal >= 0 {
+		defer followSize(terminal, func(opts types.ResizeOptions) error {
+			return cli.ContainerExecResize(ctx, created.ID, opts)
+		})()
+	}
+
+	if err := <-outputDone; err != nil {
+		return 0, fmt.Errorf("Error reading exec output: %v", err)
+	}
+	inspect, err := cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, fmt.Errorf("Error inspecting exec: %v", err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// Down stops and removes the container name, and its home volume if volumes is set
+func Down(cli lifecycleAPI, name string, volumes bool) error {
+	ctx := context.Background()
+	err := cli.ContainerStop(ctx, name, nil)
+	if client.IsErrNotFound(err) {
+		log.Printf("Container %s doesn't exist", name)
+	} else if err != nil {
+		return fmt.Errorf("Error stopping container %s: %v", name, err)
+	} else if err := cli.ContainerRemove(ctx, name, types.ContainerRemoveOptions{}); err != nil {
+		return fmt.Errorf("Error removing container %s: %v", name, err)
+	}
+
+	if volumes {
+		err := cli.VolumeRemove(ctx, HomeVolume(name), false)
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("Error removing volume %s: %v", HomeVolume(name), err)
+		}
+	}
+	return nil
+}
+
+// List returns the containers managed by godot, running or not
+func List(cli lifecycleAPI) ([]types.Container, error) {
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", RepositoryLabel)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing containers: %v", err)
+	}
+	return containers, nil
+}
@@ -0,0 +1,230 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/pmalmgren/godot/conf"
+)
+
+// MockLifecycleClient keeps containers by name and records the calls made
+type MockLifecycleClient struct {
+	MockContainerClient
+	Containers map[string]types.ContainerJSON
+	ExitCode   int
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string  { return "No such container" }
+func (notFoundError) NotFound() bool { return true }
+
+func (m *MockLifecycleClient) ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error) {
+	c, ok := m.Containers[container]
+	if !ok {
+		return types.ContainerJSON{}, notFoundError{}
+	}
+	return c, nil
+}
+
+func (m *MockLifecycleClient) ContainerCreate(ctx context.Context, config *containertypes.Config, hostConfig *containertypes.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (containertypes.ContainerCreateCreatedBody, error) {
+	m.Calls = append(m.Calls, "create "+containerName)
+	return containertypes.ContainerCreateCreatedBody{ID: "new"}, nil
+}
+
+func (m *MockLifecycleClient) ContainerStart(ctx context.Context, container string, options types.ContainerStartOptions) error {
+	m.Calls = append(m.Calls, "start "+container)
+	return nil
+}
+
+func (m *MockLifecycleClient) ContainerStop(ctx context.Context, container string, timeout *time.Duration) error {
+	m.Calls = append(m.Calls, "stop "+container)
+	if _, ok := m.Containers[container]; !ok {
+		return notFoundError{}
+	}
+	return nil
+}
+
+func (m *MockLifecycleClient) ContainerRemove(ctx context.Context, container string, options types.ContainerRemoveOptions) error {
+	m.Calls = append(m.Calls, "remove "+container)
+	return nil
+}
+
+func (m *MockLifecycleClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return nil, nil
+}
+
+func (m *MockLifecycleClient) ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error) {
+	m.Calls = append(m.Calls, "exec "+strings.Join(config.Cmd, " "))
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+func (m *MockLifecycleClient) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	m.exited = make(chan struct{})
+	close(m.exited)
+	return m.ContainerAttach(ctx, execID, types.ContainerAttachOptions{})
+}
+
+func (m *MockLifecycleClient) ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error {
+	return nil
+}
+
+func (m *MockLifecycleClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	return types.ContainerExecInspect{ExitCode: m.ExitCode}, nil
+}
+
+func (m *MockLifecycleClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	m.Calls = append(m.Calls, "remove volume "+volumeID)
+	return nil
+}
+
+// containerJSON is an inspected container running, or not, image with an empty configuration
+func containerJSON(image string, running bool) types.ContainerJSON {
+	spec, session, _ := specHash(&containertypes.Config{}, &containertypes.HostConfig{})
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "old",
+			Image: image,
+			State: &types.ContainerState{Running: running},
+		},
+		Config: &containertypes.Config{Labels: map[string]string{SpecLabel: spec, SessionLabel: session}},
+	}
+}
+
+// reconfigured is an inspected container of the current image with other mounts
+func reconfigured(running bool) types.ContainerJSON {
+	c := containerJSON("sha256:current", running)
+	c.Config.Labels[SpecLabel] = "other"
+	return c
+}
+
+// otherSession is an inspected running container started from another project directory
+func otherSession() types.ContainerJSON {
+	c := containerJSON("sha256:current", true)
+	c.Config.Labels[SessionLabel] = "other"
+	return c
+}
+
+func TestName(t *testing.T) {
+	gdc := &conf.GoDotConfig{ImageTag: "registry:5000/dev-env:latest", Profile: "work"}
+	if name := Name(gdc); name != "godot-registry-5000-dev-env-latest-work" {
+		t.Errorf("Unexpected container name %s", name)
+	}
+}
+
+func TestUpSpec(t *testing.T) {
+	gdc := &conf.GoDotConfig{ImageTag: "dev-env", Username: "me"}
+	labels := map[string]string{RepositoryLabel: "https://example.com/dotfiles"}
+	config, hostConfig, err := UpSpec(gdc, "dev-env", "", labels)
+	if err != nil {
+		t.Fatalf("Error creating container spec: %v", err)
+	}
+	if hostConfig.AutoRemove || config.Labels[RepositoryLabel] == "" {
+		t.Errorf("Expected a labeled container that isn't removed, got %+v", config)
+	}
+	if !config.Tty || !config.OpenStdin || config.AttachStdin {
+		t.Errorf("Expected a detached container with an open stdin, got %+v", config)
+	}
+	if len(hostConfig.Binds) != 1 || hostConfig.Binds[0] != "godot-dev-env-home:/home/me" {
+		t.Errorf("Expected the home directory on a volume, got %v", hostConfig.Binds)
+	}
+}
+
+func TestUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing map[string]types.ContainerJSON
+		recreate bool
+		calls    string
+	}{
+		{"missing", nil, false, "create env,start new"},
+		{"running", map[string]types.ContainerJSON{"env": containerJSON("sha256:current", true)}, false, ""},
+		{"stopped", map[string]types.ContainerJSON{"env": containerJSON("sha256:current", false)}, false, "start old"},
+		{"outdated", map[string]types.ContainerJSON{"env": containerJSON("sha256:old", false)}, false, "remove old,create env,start new"},
+		{"reconfigured", map[string]types.ContainerJSON{"env": reconfigured(false)}, false, "remove old,create env,start new"},
+		{"outdated running", map[string]types.ContainerJSON{"env": containerJSON("sha256:old", true)}, false, ""},
+		{"reconfigured running", map[string]types.ContainerJSON{"env": reconfigured(true)}, false, ""},
+		{"other session", map[string]types.ContainerJSON{"env": otherSession()}, false, ""},
+		{"recreate", map[string]types.ContainerJSON{"env": containerJSON("sha256:old", true)}, true, "remove old,create env,start new"},
+	}
+	for _, test := range tests {
+		mock := &MockLifecycleClient{Containers: test.existing}
+		if _, err := Up(mock, "env", "sha256:current", &containertypes.Config{}, &containertypes.HostConfig{}, test.recreate); err != nil {
+			t.Errorf("%s: error starting container: %v", test.name, err)
+		}
+		if calls := strings.Join(mock.Calls, ","); calls != test.calls {
+			t.Errorf("%s: expected calls %q, got %q", test.name, test.calls, calls)
+		}
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	config := &containertypes.Config{Env: []string{"EDITOR=vim"}}
+	hostConfig := &containertypes.HostConfig{Binds: []string{"godot-env-home:/home/me"}}
+	spec, session, err := specHash(config, hostConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// another terminal, in another directory and with another agent
+	f := Forward{SSHAuthSock: "/tmp/ssh-other/agent.1", GitName: "me"}
+	config.WorkingDir = DefaultWorkdir
+	hostConfig.Binds = append(hostConfig.Binds, "/home/me/other:"+DefaultWorkdir)
+	f.Apply(config, hostConfig)
+	otherSpec, otherSession, err := specHash(config, hostConfig)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if otherSpec != spec || otherSession == session {
+		t.Errorf("Expected only the session to change")
+	}
+
+	hostConfig.Binds = append(hostConfig.Binds, "/data:/data")
+	if changed, _, _ := specHash(config, hostConfig); changed == spec {
+		t.Errorf("Expected a new volume to change the spec")
+	}
+}
+
+func TestExec(t *testing.T) {
+	mock := &MockLifecycleClient{ExitCode: 2}
+	mock.Output = frame(1, "hi\n")
+	var stdout bytes.Buffer
+	code, err := Exec(mock, "env", []string{"/bin/zsh"}, false, Streams{In: bufio.NewReader(strings.NewReader("")), Out: &stdout})
+	if err != nil {
+		t.Fatalf("Error running exec: %v", err)
+	}
+	if code != 2 || stdout.String() != "hi\n" {
+		t.Errorf("Expected exit code 2 and output hi, got %d and %q", code, stdout.String())
+	}
+}
+
+func TestDown(t *testing.T) {
+	mock := &MockLifecycleClient{Containers: map[string]types.ContainerJSON{"env": containerJSON("sha256:current", true)}}
+	if err := Down(mock, "env", true); err != nil {
+		t.Fatalf("Error removing container: %v", err)
+	}
+	if expected := "stop env,remove env,remove volume env-home"; strings.Join(mock.Calls, ",") != expected {
+		t.Errorf("Expected calls %q, got %q", expected, strings.Join(mock.Calls, ","))
+	}
+
+	mock = &MockLifecycleClient{}
+	if err := Down(mock, "env", false); err != nil {
+		t.Errorf("Expected a missing container to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/pmalmgren/godot/term"
+)
+
+// containerAPI is the part of the Docker client used to run containers
+type containerAPI interface {
+	ContainerCreate(ctx context.Context, config *containertypes.Config, hostConfig *containertypes.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (containertypes.ContainerCreateCreatedBody, error)
+	ContainerAttach(ctx context.Context, container string, options types.ContainerAttachOptions) (types.HijackedResponse, error)
+	ContainerStart(ctx context.Context, container string, options types.ContainerStartOptions) error
+	ContainerResize(ctx context.Context, container string, options types.ResizeOptions) error
+	ContainerKill(ctx context.Context, container string, signal string) error
+	ContainerWait(ctx context.Context, container string, condition containertypes.WaitCondition) (<-chan containertypes.ContainerWaitOKBody, <-chan error)
+	ContainerRemove(ctx context.Context, container string, options types.ContainerRemoveOptions) error
+}
+
+// Streams are the standard streams a container is attached to
+type Streams struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// signalNames are the signals forwarded to the container, by their Docker name
+var signalNames = map[os.Signal]string{
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGHUP:  "SIGHUP",
+}
+
+// Run creates a container, attaches streams to it and starts it. Signals godot
+// receives are forwarded to the container and, with a TTY, the terminal is put in
+// raw mode and its size kept in sync. Run returns the container's exit code.
+func Run(cli containerAPI, config *containertypes.Config, hostConfig *containertypes.HostConfig, streams Streams) (int, error) {
+	ctx := context.Background()
+	created, err := cli.ContainerCreate(ctx, config, hostConfig, nil, "")
+	if err != nil {
+		return 0, fmt.Errorf("Error creating container: %v", err)
+	}
+	for _, warning := range created.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	id := created.ID
+
+	// wait before starting so a container that exits right away isn't missed
+	waitC, waitErrC := cli.ContainerWait(ctx, id, containertypes.WaitConditionNextExit)
+
+	resp, err := cli.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  config.AttachStdin,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		remove(cli, id)
+		return 0, fmt.Errorf("Error attaching to container: %v", err)
+	}
+	defer resp.Close()
+
+	terminal, restore, err := rawTerminal(streams, config.Tty)
+	if err != nil {
+		remove(cli, id)
+		return 0, err
+	}
+	defer restore()
+	outputDone := stream(resp, config.Tty, config.AttachStdin, streams)
+
+	if err := cli.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+		remove(cli, id)
+		return 0, fmt.Errorf("Error starting container: %v", err)
+	}
+
+	if terminal >= 0 {
+		defer followSize(terminal, func(opts types.ResizeOptions) error {
+			return cli.ContainerResize(ctx, id, opts)
+		})()
+	}
+
+	signals := make(chan os.Signal, 1)
+	for sig := range signalNames {
+		signal.Notify(signals, sig)
+	}
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if err := cli.ContainerKill(ctx, id, signalNames[sig]); err != nil {
+				log.Printf("Error forwarding %s to container: %v", signalNames[sig], err)
+			}
+		}
+	}()
+
+	if err := <-outputDone; err != nil {
+		return 0, fmt.Errorf("Error reading container output: %v", err)
+	}
+	select {
+	case status := <-waitC:
+		if status.Error != nil {
+			return 0, fmt.Errorf("Error waiting for container: %s", status.Error.Message)
+		}
+		return int(status.StatusCode), nil
+	case err := <-waitErrC:
+		return 0, fmt.Errorf("Error waiting for container: %v", err)
+	}
+}
+
+// rawTerminal puts the terminal of streams.In in raw mode when tty is set and it is
+// a terminal. It returns the terminal's fd, or -1, and a function restoring it.
+func rawTerminal(streams Streams, tty bool) (int, func(), error) {
+	f, ok := streams.In.(*os.File)
+	if !ok || !tty || !term.IsTerminal(f.Fd()) {
+		return -1, func() {}, nil
+	}
+	restore, err := term.MakeRaw(f.Fd())
+	if err != nil {
+		return -1, nil, fmt.Errorf("Error setting terminal to raw mode: %v", err)
+	}
+	return int(f.Fd()), restore, nil
+}
+
+// stream copies the output of resp to streams, demultiplexing it without a TTY, and
+// stdin to resp. The returned channel receives the result once the output ends.
+func stream(resp types.HijackedResponse, tty bool, stdin bool, streams Streams) <-chan error {
+	outputDone := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(streams.Out, resp.Reader)
+		} else {
+			err = demultiplex(streams.Out, streams.Err, resp.Reader)
+		}
+		outputDone <- err
+	}()
+	if stdin && streams.In != nil {
+		go func() {
+			io.Copy(resp.Conn, streams.In)
+			resp.CloseWrite()
+		}()
+	}
+	return outputDone
+}
+
+// followSize resizes the container's terminal to the size of the terminal fd now
+// and whenever it changes, until the returned function is called
+func followSize(fd int, resize func(types.ResizeOptions) error) func() {
+	apply := func() {
+		height, width, err := term.Size(uintptr(fd))
+		if err != nil || height == 0 || width == 0 {
+			return
+		}
+		opts := types.ResizeOptions{Height: uint(height), Width: uint(width)}
+		if err := resize(opts); err != nil {
+			log.Printf("Error resizing container terminal: %v", err)
+		}
+	}
+	apply()
+	resized := make(chan os.Signal, 1)
+	term.NotifyResize(resized)
+	go func() {
+		for range resized {
+			apply()
+		}
+	}()
+	return func() {
+		signal.Stop(resized)
+	}
+}
+
+// remove removes a container that was created but won't run
+func remove(cli containerAPI, id string) {
+	opts := types.ContainerRemoveOptions{Force: true}
+	if err := cli.ContainerRemove(context.Background(), id, opts); err != nil {
+		log.Printf("Error removing container %s: %v", id, err)
+	}
+}
+
+// demultiplex splits the output of a container without a TTY into stdout and
+// stderr. Docker prefixes every frame with an 8 byte header: the stream (1 for
+// stdout, 2 for stderr), three zero bytes and the big endian frame size.
+func demultiplex(stdout io.Writer, stderr io.Writer, in io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(in, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var out io.Writer
+		switch header[0] {
+		case 0, 1:
+			out = stdout
+		case 2:
+			out = stderr
+		default:
+			return fmt.Errorf("Unknown stream %d in container output", header[0])
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, in, size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// MockContainerClient runs a fake container whose output is Output and whose exit code is StatusCode
+type MockContainerClient struct {
+	Output     []byte
+	StatusCode int64
+	Calls      []string
+	Stdin      chan string
+	exited     chan struct{}
+	stdin      bool
+}
+
+// halfCloseConn lets the mock read stdin until Run closes it
+type halfCloseConn struct {
+	net.Conn
+}
+
+func (c halfCloseConn) CloseWrite() error {
+	return c.Conn.Close()
+}
+
+func (m *MockContainerClient) ContainerCreate(ctx context.Context, config *containertypes.Config, hostConfig *containertypes.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (containertypes.ContainerCreateCreatedBody, error) {
+	m.Calls = append(m.Calls, "create")
+	m.exited = make(chan struct{})
+	return containertypes.ContainerCreateCreatedBody{ID: "abc"}, nil
+}
+
+func (m *MockContainerClient) ContainerAttach(ctx context.Context, container string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	m.Calls = append(m.Calls, "attach")
+	client, server := net.Pipe()
+	m.Stdin = make(chan string, 1)
+	m.stdin = options.Stdin
+	go func() {
+		stdin, _ := ioutil.ReadAll(server)
+		m.Stdin <- string(stdin)
+		// a container attached to stdin exits once stdin is closed
+		if m.stdin {
+			close(m.exited)
+		}
+	}()
+	// the output ends when the container exits
+	r := &exitReader{r: bytes.NewReader(m.Output), exited: m.exited}
+	return types.HijackedResponse{Conn: halfCloseConn{client}, Reader: bufio.NewReader(r)}, nil
+}
+
+func (m *MockContainerClient) ContainerStart(ctx context.Context, container string, options types.ContainerStartOptions) error {
+	m.Calls = append(m.Calls, "start")
+	if !m.stdin {
+		close(m.exited)
+	}
+	return nil
+}
+
+func (m *MockContainerClient) ContainerResize(ctx context.Context, container string, options types.ResizeOptions) error {
+	return nil
+}
+
+func (m *MockContainerClient) ContainerKill(ctx context.Context, container string, signal string) error {
+	return nil
+}
+
+func (m *MockContainerClient) ContainerWait(ctx context.Context, container string, condition containertypes.WaitCondition) (<-chan containertypes.ContainerWaitOKBody, <-chan error) {
+	m.Calls = append(m.Calls, "wait")
+	waitC := make(chan containertypes.ContainerWaitOKBody, 1)
+	go func() {
+		<-m.exited
+		waitC <- containertypes.ContainerWaitOKBody{StatusCode: m.StatusCode}
+	}()
+	return waitC, make(chan error)
+}
+
+func (m *MockContainerClient) ContainerRemove(ctx context.Context, container string, options types.ContainerRemoveOptions) error {
+	m.Calls = append(m.Calls, "remove")
+	return nil
+}
+
+// exitReader reads from r once the container has exited
+type exitReader struct {
+	r      *bytes.Reader
+	exited chan struct{}
+}
+
+func (e *exitReader) Read(p []byte) (int, error) {
+	<-e.exited
+	return e.r.Read(p)
+}
+
+// frame multiplexes data onto stream the way Docker does without a TTY
+func frame(stream byte, data string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestRun(t *testing.T) {
+	output := append(frame(1, "hello\n"), frame(2, "oops\n")...)
+	output = append(output, frame(1, "bye\n")...)
+	mock := &MockContainerClient{Output: output, StatusCode: 3}
+	config := &containertypes.Config{Image: "dev-env", AttachStdin: true, OpenStdin: true}
+
+	var stdout, stderr bytes.Buffer
+	streams := Streams{In: strings.NewReader("input"), Out: &stdout, Err: &stderr}
+	code, err := Run(mock, config, &containertypes.HostConfig{}, streams)
+	if err != nil {
+		t.Fatalf("Error running container: %v", err)
+	}
+	if code != 3 {
+		t.Errorf("Expected exit code 3, got %d", code)
+	}
+	if stdout.String() != "hello\nbye\n" || stderr.String() != "oops\n" {
+		t.Errorf("Expected stdout and stderr to be split, got %q and %q", stdout.String(), stderr.String())
+	}
+	if stdin := <-mock.Stdin; stdin != "input" {
+		t.Errorf("Expected stdin to be forwarded, got %q", stdin)
+	}
+	if expected := "create wait attach start"; strings.Join(mock.Calls, " ") != expected {
+		t.Errorf("Expected calls %s, got %v", expected, mock.Calls)
+	}
+}
+
+func TestRunTTY(t *testing.T) {
+	mock := &MockContainerClient{Output: []byte("raw \x01 output")}
+	config := &containertypes.Config{Image: "dev-env", Tty: true}
+
+	var stdout bytes.Buffer
+	code, err := Run(mock, config, &containertypes.HostConfig{}, Streams{Out: &stdout})
+	if err != nil {
+		t.Fatalf("Error running container: %v", err)
+	}
+	if code != 0 || stdout.String() != "raw \x01 output" {
+		t.Errorf("Expected exit code 0 and raw output, got %d and %q", code, stdout.String())
+	}
+}
+
+func TestDemultiplexUnknownStream(t *testing.T) {
+	err := demultiplex(ioutil.Discard, ioutil.Discard, bytes.NewReader(frame(7, "x")))
+	if err == nil {
+		t.Errorf("Expected an error for an unknown stream")
+	}
+}
@@ -0,0 +1,101 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+// Package dockerfile builds Dockerfiles from typed instructions, so generated
+// Dockerfiles are quoted and escaped correctly.
+package dockerfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Instruction is a single Dockerfile instruction
+type Instruction interface {
+	// String serializes the instruction as Dockerfile source
+	String() string
+}
+
+// Dockerfile is an ordered list of instructions
+type Dockerfile struct {
+	Instructions []Instruction
+}
+
+// Add appends instructions to the Dockerfile
+func (d *Dockerfile) Add(instructions ...Instruction) {
+	d.Instructions = append(d.Instructions, instructions...)
+}
+
+// Insert adds instructions before the instruction at index i
+func (d *Dockerfile) Insert(i int, instructions ...Instruction) {
+	tail := append([]Instruction{}, d.Instructions[i:]...)
+	d.Instructions = append(append(d.Instructions[:i], instructions...), tail...)
+}
+
+// Index returns the index of the first instruction that matches, or -1
+func (d *Dockerfile) Index(match func(Instruction) bool) int {
+	for i, instruction := range d.Instructions {
+		if match(instruction) {
+			return i
+		}
+	}
+	return -1
+}
+
+// String serializes the Dockerfile, every comment starts a new paragraph
+func (d *Dockerfile) String() string {
+	var buf bytes.Buffer
+	for i, instruction := range d.Instructions {
+		if _, ok := instruction.(Comment); ok && i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(instruction.String())
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// execForm serializes arguments as a JSON array, the exec form of CMD, COPY and friends
+func execForm(args []string) string {
+	if args == nil {
+		args = []string{}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// encoding a []string can't fail
+	enc.Encode(args)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// quote quotes a word for ENV, ARG and LABEL when it contains whitespace, quotes or
+// backslashes. Variable references such as $HOME are left for Docker to expand.
+func quote(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t\r\n\"'\\") {
+		return word
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(word) + `"`
+}
+
+// continueLines turns newlines in shell-form arguments into line continuations
+func continueLines(s string) string {
+	return strings.Replace(s, "\n", " \\\n", -1)
+}
+
+// needsExecForm reports whether paths must use the JSON form to survive whitespace
+func needsExecForm(paths []string) bool {
+	for _, path := range paths {
+		if strings.ContainsAny(path, " \t\"") {
+			return true
+		}
+	}
+	return false
+}
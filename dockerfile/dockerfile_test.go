@@ -0,0 +1,63 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package dockerfile
+
+import (
+	"testing"
+)
+
+func TestInstructions(t *testing.T) {
+	tests := []struct {
+		instruction Instruction
+		expected    string
+	}{
+		{From{Image: "debian:bookworm-slim"}, "FROM debian:bookworm-slim"},
+		{From{Image: "golang:1.21", Name: "build"}, "FROM golang:1.21 AS build"},
+		{Arg{Name: "username"}, "ARG username"},
+		{Arg{Name: "username", Default: "me"}, "ARG username=me"},
+		{Arg{Name: "greeting", Default: `say "hi"`}, `ARG greeting="say \"hi\""`},
+		{Run{Commands: []string{"apt-get update", "apt-get install -y g++ && echo '<ok>'"}}, "RUN apt-get update && \\\n    apt-get install -y g++ && echo '<ok>'"},
+		{Run{Commands: []string{"if true; then\necho yes; fi"}}, "RUN if true; then \\\necho yes; fi"},
+		{Copy{Sources: []string{"dotfiles/"}, Dest: "/home/$username/dotfiles/"}, "COPY dotfiles/ /home/$username/dotfiles/"},
+		{Copy{Sources: []string{"my dotfiles/"}, Dest: "/home/me/", Chown: "me:me", Chmod: "0755"}, `COPY --chown=me:me --chmod=0755 ["my dotfiles/","/home/me/"]`},
+		{User{Name: "$username"}, "USER $username"},
+		{Workdir{Path: "/home/$username"}, "WORKDIR /home/$username"},
+		{Env{Vars: []KeyValue{{"LANG", "en_US.UTF-8"}, {"PS1", `\u@\h $ `}}}, `ENV LANG=en_US.UTF-8 PS1="\\u@\\h $ "`},
+		{Label{Labels: []KeyValue{{"org.opencontainers.image.title", "dev env"}}}, `LABEL org.opencontainers.image.title="dev env"`},
+		{Cmd{Args: []string{"tmux", "new", "-A", "-s", "<main>&"}}, `CMD ["tmux","new","-A","-s","<main>&"]`},
+		{Cmd{}, `CMD []`},
+		{Comment{Text: "two\nlines"}, "# two\n# lines"},
+		{Raw{Source: "RUN echo raw && true"}, "RUN echo raw && true"},
+	}
+	for _, test := range tests {
+		if actual := test.instruction.String(); actual != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, actual)
+		}
+	}
+}
+
+func TestDockerfile(t *testing.T) {
+	df := &Dockerfile{}
+	df.Add(
+		From{Image: "alpine"},
+		Comment{Text: "Setup"},
+		Run{Commands: []string{"apk add git"}},
+		Cmd{Args: []string{"sh"}},
+	)
+	df.Insert(df.Index(func(i Instruction) bool {
+		_, ok := i.(Cmd)
+		return ok
+	}), User{Name: "me"})
+
+	expected := "FROM alpine\n\n# Setup\nRUN apk add git\nUSER me\nCMD [\"sh\"]\n"
+	if actual := df.String(); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,155 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package dockerfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyValue is a key and value pair of ENV or LABEL
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Comment is a `#` comment line
+type Comment struct {
+	Text string
+}
+
+func (c Comment) String() string {
+	return "# " + strings.Replace(c.Text, "\n", "\n# ", -1)
+}
+
+// From starts a build stage from an image, Name optionally names the stage
+type From struct {
+	Image string
+	Name  string
+}
+
+func (f From) String() string {
+	if f.Name != "" {
+		return fmt.Sprintf("FROM %s AS %s", f.Image, f.Name)
+	}
+	return "FROM " + f.Image
+}
+
+// Arg declares a build argument with an optional default value
+type Arg struct {
+	Name    string
+	Default string
+}
+
+func (a Arg) String() string {
+	if a.Default == "" {
+		return "ARG " + a.Name
+	}
+	return fmt.Sprintf("ARG %s=%s", a.Name, quote(a.Default))
+}
+
+// Run runs shell commands, which are chained with && so any failure stops the build
+type Run struct {
+	Commands []string
+}
+
+func (r Run) String() string {
+	commands := make([]string, len(r.Commands))
+	for i, command := range r.Commands {
+		commands[i] = continueLines(command)
+	}
+	return "RUN " + strings.Join(commands, " && \\\n    ")
+}
+
+// Copy copies files from the build context. Chown and Chmod are optional.
+type Copy struct {
+	Sources []string
+	Dest    string
+	Chown   string
+	Chmod   string
+}
+
+func (c Copy) String() string {
+	s := "COPY"
+	if c.Chown != "" {
+		s += " --chown=" + c.Chown
+	}
+	if c.Chmod != "" {
+		s += " --chmod=" + c.Chmod
+	}
+	paths := append(append([]string{}, c.Sources...), c.Dest)
+	if needsExecForm(paths) {
+		return s + " " + execForm(paths)
+	}
+	return s + " " + strings.Join(paths, " ")
+}
+
+// User sets the user, and optionally the group, following instructions run as
+type User struct {
+	Name string
+}
+
+func (u User) String() string {
+	return "USER " + u.Name
+}
+
+// Workdir sets the working directory of following instructions
+type Workdir struct {
+	Path string
+}
+
+func (w Workdir) String() string {
+	return "WORKDIR " + w.Path
+}
+
+// Env sets environment variables
+type Env struct {
+	Vars []KeyValue
+}
+
+func (e Env) String() string {
+	return "ENV " + keyValues(e.Vars)
+}
+
+// Label adds metadata to the image
+type Label struct {
+	Labels []KeyValue
+}
+
+func (l Label) String() string {
+	return "LABEL " + keyValues(l.Labels)
+}
+
+func keyValues(pairs []KeyValue) string {
+	parts := make([]string, len(pairs))
+	for i, kv := range pairs {
+		parts[i] = kv.Key + "=" + quote(kv.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Cmd sets the default command of the image, in exec form
+type Cmd struct {
+	Args []string
+}
+
+func (c Cmd) String() string {
+	return "CMD " + execForm(c.Args)
+}
+
+// Raw is Dockerfile source written by a user, such as a setup step, and is
+// serialized as-is
+type Raw struct {
+	Source string
+}
+
+func (r Raw) String() string {
+	return r.Source
+}
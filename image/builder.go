@@ -10,33 +10,28 @@
 package image
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 
 	"github.com/docker/docker/api/types"
-	"github.com/jhoonb/archivex"
+	"github.com/pmalmgren/godot/term"
 )
 
 type imagebuilder interface {
 	ImageBuild(context.Context, io.Reader, types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	ImageInspectWithRaw(context.Context, string) (types.ImageInspect, []byte, error)
 }
 
-type dockerCliOutput struct {
-	Stream string `json:"stream"`
-}
-
-// BuildDockerImage builds a Docker image from a directory, specified on contextPath
-func BuildDockerImage(cli imagebuilder, contextPath string, tag string) error {
-	dockerBuildContext, err := os.Open(contextPath)
-	if err != nil {
-		return fmt.Errorf("Error opening build context tarfile: %v", err)
+// BuildDockerImage builds a Docker image from a build context, see BuildContext,
+// and returns the ID of the built image, the sha256 digest of its configuration
+func BuildDockerImage(cli imagebuilder, buildContext io.Reader, tag string, labels map[string]string, buildArgs map[string]string) (string, error) {
+	args := make(map[string]*string, len(buildArgs))
+	for name, value := range buildArgs {
+		value := value
+		args[name] = &value
 	}
 	options := types.ImageBuildOptions{
 		SuppressOutput: false,
@@ -45,10 +40,12 @@ func BuildDockerImage(cli imagebuilder, contextPath string, tag string) error {
 		PullParent:     true,
 		Tags:           []string{tag},
 		Dockerfile:     "Dockerfile",
+		Labels:         labels,
+		BuildArgs:      args,
 	}
-	buildResponse, err := cli.ImageBuild(context.Background(), dockerBuildContext, options)
+	buildResponse, err := cli.ImageBuild(context.Background(), buildContext, options)
 	if err != nil {
-		return fmt.Errorf("Error building Docker image: %v", err)
+		return "", fmt.Errorf("Error building Docker image: %v", err)
 	}
 	defer func() {
 		if err := buildResponse.Body.Close(); err != nil {
@@ -56,86 +53,7 @@ func BuildDockerImage(cli imagebuilder, contextPath string, tag string) error {
 		}
 	}()
 
-	log.Printf("Building Docker image from build context %s", contextPath)
-
-	reader := bufio.NewReader(buildResponse.Body)
-	for {
-		line, err := reader.ReadBytes('\r')
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("Error reading from Docker: %v", err)
-		}
-
-		line = bytes.TrimSpace(line)
-		var output dockerCliOutput
-		json.Unmarshal(line, &output)
-
-		fmt.Printf("%s", output.Stream)
-
-		if err != nil {
-			break
-		}
-	}
-
-	return nil
-}
-
-// isolateDockerfile moves a Dockerfile to its own temporary directory
-func isolateDockerfile(dockerfilePath string) (string, error) {
-	dockerfileContents, err := ioutil.ReadFile(dockerfilePath)
-	if err != nil {
-		return "", fmt.Errorf("Error reading from Dockerfile: %v", err)
-	}
-
-	tmpDir, err := ioutil.TempDir("/tmp/", "dockerfile-directory")
-	if err != nil {
-		return "", fmt.Errorf("Error creating temporary directory: %v", err)
-	}
-
-	newDockerfilePath := fmt.Sprintf("%s/Dockerfile", tmpDir)
-	err = ioutil.WriteFile(newDockerfilePath, []byte(dockerfileContents), 0666)
-	if err != nil {
-		return "", fmt.Errorf("Error writing to Docker build context file: %v", err)
-	}
-
-	return tmpDir, nil
-}
-
-// BuildDockerContext adds directories and a Dockerfile to a tarball.
-// The caller is responsible for cleanup.
-func BuildDockerContext(dockerfilePath string, dirs ...string) (string, error) {
-	// move the Dockerfile to its own path
-	newDockerfilePath, err := isolateDockerfile(dockerfilePath)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		if err := os.RemoveAll(newDockerfilePath); err != nil {
-			log.Printf("Error removing Dockerfile path: %v", err)
-		}
-	}()
-
-	tar := new(archivex.TarFile)
-	tmpDir, err := ioutil.TempDir("/tmp", "")
-	if err != nil {
-		return "", fmt.Errorf("Error creating a temporary directory: %v", err)
-	}
-	tarPath := fmt.Sprintf("%s/buildcontext.tar", tmpDir)
-	if err := tar.Create(tarPath); err != nil {
-		log.Printf("Error creating Docker build context tarfile: %v", err)
-	}
-	if err := tar.AddAll(newDockerfilePath, false); err != nil {
-		return "", fmt.Errorf("Error adding Dockerfile to build context: %v", err)
-	}
-
-	for _, dir := range dirs {
-		if err := tar.AddAll(dir, true); err != nil {
-			return "", fmt.Errorf("Error adding directory %s to build context: %v", dir, err)
-		}
-	}
-
-	if err := tar.Close(); err != nil {
-		return "", fmt.Errorf("Error closing Docker build context file: %v", err)
-	}
+	log.Printf("Building Docker image %s", tag)
 
-	return tarPath, nil
+	return displayBuildOutput(buildResponse.Body, os.Stdout, term.IsTerminal(os.Stdout.Fd()))
 }
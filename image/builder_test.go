@@ -10,68 +10,67 @@ package image
 
 import (
 	"archive/tar"
-	"bufio"
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/docker/docker/api/types"
 )
 
-func getBuildContext(t *testing.T) string {
+// writeDotfiles creates a repository with a dotfiles directory to build a context from
+func writeDotfiles(t *testing.T) string {
 	tmpDir, err := ioutil.TempDir("/tmp", "")
 	if err != nil {
 		t.Fatalf("Error creating temporary directory: %v", err)
 	}
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			t.Logf("Error removing temporary directory %s: %v", tmpDir, err)
+	testDirPath := filepath.Join(tmpDir, "dotfiles")
+	for _, dir := range []string{"zsh", "empty", ".git", "cache/nested"} {
+		if err := os.MkdirAll(filepath.Join(testDirPath, dir), 0755); err != nil {
+			t.Fatalf("Error writing temporary directory: %v", err)
 		}
-	}()
-	dockerPath := fmt.Sprintf("%s/Dockerfile", tmpDir)
-	testDirPath := fmt.Sprintf("%s/dotfiles", tmpDir)
-	testFilePath := fmt.Sprintf("%s/test.txt", testDirPath)
-	if err := ioutil.WriteFile(dockerPath, []byte("foo"), 0777); err != nil {
-		t.Fatalf("Error writing temporary Dockerfile: %v", err)
 	}
-	if err := os.Mkdir(testDirPath, 0777); err != nil {
-		t.Fatalf("Error writing temporary directory: %v", err)
+	files := map[string]string{
+		"test.txt":          "bar",
+		"zsh/.zshrc":        "zshrc",
+		"zsh/secret.log":    "ignored",
+		"zsh/keep.log":      "kept",
+		"cache/nested/file": "ignored",
+		".git/HEAD":         "ignored",
+		".godotignore":      "# comments are skipped\n**/*.log\n!zsh/keep.log\ncache\n",
 	}
-	if err := ioutil.WriteFile(testFilePath, []byte("bar"), 0644); err != nil {
-		t.Fatalf("Error writing test file: %v", err)
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(testDirPath, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing test file: %v", err)
+		}
 	}
-
-	dockerContext, err := BuildDockerContext(dockerPath, testDirPath)
-	if err != nil {
-		t.Fatalf("Error creating docker build context: %v", err)
+	if err := os.Chmod(filepath.Join(testDirPath, "test.txt"), 0755); err != nil {
+		t.Fatalf("Error changing file mode: %v", err)
 	}
-
-	return dockerContext
+	if err := os.Symlink("zsh/.zshrc", filepath.Join(testDirPath, "link")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+	return tmpDir
 }
 
-func TestBuildDockerContext(t *testing.T) {
-	dockerContext := getBuildContext(t)
-	file, err := os.Open(dockerContext)
-	if err != nil {
-		t.Fatalf("Error opening build context: %v", err)
-	}
+func TestBuildContext(t *testing.T) {
+	repoDir := writeDotfiles(t)
 	defer func() {
-		if err := os.Remove(dockerContext); err != nil {
-			t.Logf("Error removing temporary build context: %v", err)
-		}
-		if err := os.RemoveAll(filepath.Dir(dockerContext)); err != nil {
-			t.Logf("Error removing temporary build context: %v", err)
+		if err := os.RemoveAll(repoDir); err != nil {
+			t.Logf("Error removing temporary directory %s: %v", repoDir, err)
 		}
 	}()
-	tr := tar.NewReader(bufio.NewReader(file))
+	dockerContext := BuildContext([]byte("foo"), repoDir, "dotfiles")
+	defer dockerContext.Close()
+
+	tr := tar.NewReader(dockerContext)
 	actual := make(map[string]string)
+	headers := make(map[string]*tar.Header)
 	for {
-		buf := make([]byte, 12)
 		hdrf, err := tr.Next()
 		if err == io.EOF {
 			break
@@ -79,20 +78,32 @@ func TestBuildDockerContext(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Fatal error reading Docker Context: %v", err)
 		}
-		if _, err := tr.Read(buf); err != nil && err != io.EOF {
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
 			t.Fatalf("Fatal error reading from tarfile: %v", err)
 		}
-		actual[hdrf.Name] = string(bytes.Trim(buf, "\x00"))
+		actual[hdrf.Name] = string(buf)
+		headers[hdrf.Name] = hdrf
 	}
-	expected := map[string]string{"Dockerfile": "foo", "dotfiles/test.txt": "bar"}
-	for k, v := range expected {
-		av, ok := actual[k]
-		if !ok {
-			t.Errorf("Dockerfile missing file: %s", k)
-		}
-		if av != v {
-			t.Errorf("Dockerfile contents of file %s invalid: %v != %v", k, []byte(av), []byte(v))
-		}
+	expected := map[string]string{
+		"Dockerfile":            "foo",
+		"dotfiles/":             "",
+		"dotfiles/.godotignore": "# comments are skipped\n**/*.log\n!zsh/keep.log\ncache\n",
+		"dotfiles/empty/":       "",
+		"dotfiles/link":         "",
+		"dotfiles/test.txt":     "bar",
+		"dotfiles/zsh/":         "",
+		"dotfiles/zsh/.zshrc":   "zshrc",
+		"dotfiles/zsh/keep.log": "kept",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Build context contents invalid:\n%v\n!=\n%v", actual, expected)
+	}
+	if hdr := headers["dotfiles/link"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "zsh/.zshrc" {
+		t.Errorf("Symlink not preserved: %+v", hdr)
+	}
+	if hdr := headers["dotfiles/test.txt"]; hdr == nil || hdr.Mode&0777 != 0755 {
+		t.Errorf("File mode not preserved: %+v", hdr)
 	}
 }
 
@@ -101,25 +112,50 @@ type MockDockerClient struct {
 	Error      error
 	Dockerfile string
 	Tags       []string
+	Labels     map[string]string
+	BuildArgs  map[string]*string
+	Builds     int
+	Images     map[string]types.ImageInspect
 	t          *testing.T
 }
 
 func (mdc *MockDockerClient) ImageBuild(ctx context.Context, buf io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
 	mdc.Dockerfile = string(options.Dockerfile)
 	mdc.Tags = options.Tags
+	mdc.Labels = options.Labels
+	mdc.BuildArgs = options.BuildArgs
+	mdc.Builds++
+	if _, err := ioutil.ReadAll(buf); err != nil {
+		mdc.t.Errorf("Error reading build context: %v", err)
+	}
 
 	return mdc.Response, mdc.Error
 }
 
+type notFoundError struct{}
+
+func (notFoundError) Error() string  { return "No such image" }
+func (notFoundError) NotFound() bool { return true }
+
+func (mdc *MockDockerClient) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	inspect, ok := mdc.Images[image]
+	if !ok {
+		return types.ImageInspect{}, nil, notFoundError{}
+	}
+	return inspect, nil, nil
+}
+
 func TestBuildDockerImage(t *testing.T) {
-	response := types.ImageBuildResponse{Body: ioutil.NopCloser(bytes.NewReader([]byte("** TEST **")))}
+	stream := `{"stream":"Step 1/1 : FROM alpine\n"}{"aux":{"ID":"sha256:test"}}{"stream":"Successfully built test\n"}`
+	response := types.ImageBuildResponse{Body: ioutil.NopCloser(bytes.NewReader([]byte(stream)))}
 	mdc := &MockDockerClient{Error: nil, Response: response, t: t, Tags: []string{}}
-	dockerContext := getBuildContext(t)
-
-	err := BuildDockerImage(mdc, dockerContext, "test")
+	imageID, err := BuildDockerImage(mdc, bytes.NewReader(nil), "test", nil, nil)
 	if err != nil {
 		t.Fatalf("BuildDockerImage unexpected error: %v", err)
 	}
+	if imageID != "sha256:test" {
+		t.Errorf("BuildDockerImage returned unexpected image ID: %s", imageID)
+	}
 
 	if len(mdc.Tags) != 1 || mdc.Tags[0] != "test" {
 		t.Fatalf("Docker client called with unexpected tags: %+v", mdc.Tags)
@@ -128,3 +164,26 @@ func TestBuildDockerImage(t *testing.T) {
 		t.Fatalf("Docker client called with unexpected Dockerfile: %+v", mdc.Dockerfile)
 	}
 }
+
+func TestBuildContextFile(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	dockerContext := BuildContext([]byte("foo"), repoDir, "dotfiles/zsh/.zshrc")
+	defer dockerContext.Close()
+
+	tr := tar.NewReader(dockerContext)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Fatal error reading Docker Context: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if expected := []string{"Dockerfile", "dotfiles/zsh/.zshrc"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
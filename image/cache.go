@@ -0,0 +1,132 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/docker/docker/client"
+)
+
+// HashLabel is the image label holding the hash of the build context it was built from
+const HashLabel = "com.github.pmalmgren.godot.context-hash"
+
+// Labels recording what an image was built from
+const (
+	// RevisionLabel is the commit SHA of the dotfiles repository
+	RevisionLabel = "org.opencontainers.image.revision"
+	// SourceLabel is the remote of the dotfiles repository
+	SourceLabel = "org.opencontainers.image.source"
+	// VersionLabel is the version of godot that built the image
+	VersionLabel = "com.github.pmalmgren.godot.version"
+)
+
+// Build describes an image to build from a rendered Dockerfile and directories of a repository
+type Build struct {
+	Dockerfile []byte
+	// Root is the directory Dirs are relative to
+	Root string
+	Dirs []string
+	// Origins maps the paths in Dirs under which files come from another directory
+	// than Root to that directory
+	Origins map[string]string
+	Tag     string
+	// Labels are added to the image besides HashLabel
+	Labels map[string]string
+	// BuildArgs set the Dockerfile's ARG values
+	BuildArgs map[string]string
+	// Force builds the image even when an up to date image exists
+	Force bool
+	// Replace maps paths of files in the build context, relative to Root, to the
+	// files sent in their place
+	Replace map[string]File
+}
+
+// Context streams the build context, the caller must close it
+func (b *Build) Context() io.ReadCloser {
+	return buildContext(b.Dockerfile, b.Root, b.Dirs, b.Origins, b.Replace)
+}
+
+// Hash returns the SHA-256 of the build context, build arguments and labels. The
+// context is reproducible, so the hash only changes when the Dockerfile, the files
+// sent to Docker, the build arguments or the labels change.
+func (b *Build) Hash() (string, error) {
+	buildContext := b.Context()
+	defer buildContext.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, buildContext); err != nil {
+		return "", fmt.Errorf("Error hashing build context: %v", err)
+	}
+	hashMap(h, b.BuildArgs)
+	h.Write([]byte{0})
+	hashMap(h, b.Labels)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashMap writes m to h in a stable order
+func hashMap(h io.Writer, m map[string]string) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "\x00%s=%s", name, m[name])
+	}
+}
+
+// upToDate returns the ID of the image tagged tag if it was built from a context with hash
+func upToDate(cli imagebuilder, tag string, hash string) (string, bool, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(context.Background(), tag)
+	if client.IsErrNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("Error inspecting image %s: %v", tag, err)
+	}
+	if inspect.Config == nil || inspect.Config.Labels[HashLabel] != hash {
+		return "", false, nil
+	}
+	return inspect.ID, true, nil
+}
+
+// BuildImage builds the image described by b and returns its ID. When an image
+// with the same tag was already built from an identical context, and b.Force is
+// false, the build is skipped and the existing image's ID is returned.
+func BuildImage(cli imagebuilder, b *Build) (string, error) {
+	hash, err := b.Hash()
+	if err != nil {
+		return "", err
+	}
+	if !b.Force {
+		id, ok, err := upToDate(cli, b.Tag, hash)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			log.Printf("Image %s is up to date, skipping the build", b.Tag)
+			return id, nil
+		}
+	}
+
+	labels := map[string]string{HashLabel: hash}
+	for k, v := range b.Labels {
+		labels[k] = v
+	}
+	buildContext := b.Context()
+	defer buildContext.Close()
+	return BuildDockerImage(cli, buildContext, b.Tag, labels, b.BuildArgs)
+}
@@ -0,0 +1,119 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestBuildHash(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	build := &Build{Dockerfile: []byte("FROM alpine"), Root: repoDir, Dirs: []string{"dotfiles"}, Tag: "test"}
+
+	first, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(repoDir, "dotfiles", "test.txt"), later, later); err != nil {
+		t.Fatalf("Error changing file times: %v", err)
+	}
+	second, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("Hash changed with file times: %s != %s", first, second)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "dotfiles", "test.txt"), []byte("changed"), 0755); err != nil {
+		t.Fatalf("Error writing test file: %v", err)
+	}
+	third, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if third == first {
+		t.Errorf("Hash didn't change with file contents")
+	}
+
+	build.BuildArgs = map[string]string{"uid": "1000"}
+	fourth, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fourth == third {
+		t.Errorf("Hash didn't change with build arguments")
+	}
+
+	build.Labels = map[string]string{RevisionLabel: "abc123"}
+	fifth, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fifth == fourth {
+		t.Errorf("Hash didn't change with labels")
+	}
+}
+
+func TestBuildImageCache(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	build := &Build{Dockerfile: []byte("FROM alpine"), Root: repoDir, Dirs: []string{"dotfiles"}, Tag: "test", Labels: map[string]string{"extra": "label"}, BuildArgs: map[string]string{"uid": "1000"}}
+	hash, err := build.Hash()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stream := `{"aux":{"ID":"sha256:new"}}`
+	newMock := func() *MockDockerClient {
+		return &MockDockerClient{
+			t:        t,
+			Response: types.ImageBuildResponse{Body: ioutil.NopCloser(bytes.NewReader([]byte(stream)))},
+			Images:   map[string]types.ImageInspect{},
+		}
+	}
+
+	// nothing is tagged yet
+	mdc := newMock()
+	id, err := BuildImage(mdc, build)
+	if err != nil || id != "sha256:new" || mdc.Builds != 1 {
+		t.Fatalf("Expected a build, got id %s, %d builds, error %v", id, mdc.Builds, err)
+	}
+	if mdc.Labels[HashLabel] != hash || mdc.Labels["extra"] != "label" {
+		t.Errorf("Unexpected labels: %v", mdc.Labels)
+	}
+	if uid := mdc.BuildArgs["uid"]; uid == nil || *uid != "1000" {
+		t.Errorf("Expected build argument uid=1000, got %v", mdc.BuildArgs)
+	}
+
+	// the tagged image was built from the same context
+	mdc = newMock()
+	mdc.Images["test"] = types.ImageInspect{ID: "sha256:old", Config: &container.Config{Labels: map[string]string{HashLabel: hash}}}
+	id, err = BuildImage(mdc, build)
+	if err != nil || id != "sha256:old" || mdc.Builds != 0 {
+		t.Fatalf("Expected the build to be skipped, got id %s, %d builds, error %v", id, mdc.Builds, err)
+	}
+
+	// --force
+	build.Force = true
+	id, err = BuildImage(mdc, build)
+	if err != nil || id != "sha256:new" || mdc.Builds != 1 {
+		t.Fatalf("Expected a forced build, got id %s, %d builds, error %v", id, mdc.Builds, err)
+	}
+}
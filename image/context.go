@@ -0,0 +1,190 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// epoch is the modification time of every file in the build context
+var epoch = time.Unix(0, 0)
+
+// File is a file added to the build context in place of another, such as a
+// rendered template
+type File struct {
+	// Name is the file's path in the build context
+	Name     string
+	Contents []byte
+}
+
+// BuildContext streams a Docker build context as a tar archive. It contains the
+// Dockerfile and the directories or files dirs, which are relative to root and keep
+// their relative paths in the archive. Entries are sorted, symlinks, file modes and empty
+// directories are preserved, and each directory's .godotignore or .dockerignore is honored.
+// The caller must close the returned reader.
+func BuildContext(dockerfile []byte, root string, dirs ...string) io.ReadCloser {
+	return buildContext(dockerfile, root, dirs, nil, nil)
+}
+
+// buildContext is BuildContext with the dirs under a path of origins read from its
+// directory instead of root, and the files at the paths of replace, relative to
+// root, replaced. Replaced files keep their mode.
+func buildContext(dockerfile []byte, root string, dirs []string, origins map[string]string, replace map[string]File) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := writeContext(tw, dockerfile, root, dirs, origins, replace)
+		// closing writes the end of the archive, which would hide the error from
+		// the reader
+		if err == nil {
+			if closeErr := tw.Close(); closeErr != nil {
+				err = fmt.Errorf("Error closing Docker build context: %v", closeErr)
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func writeContext(tw *tar.Writer, dockerfile []byte, root string, dirs []string, origins map[string]string, replace map[string]File) error {
+	hdr := &tar.Header{
+		Name:     "Dockerfile",
+		Mode:     0644,
+		Size:     int64(len(dockerfile)),
+		Typeflag: tar.TypeReg,
+		ModTime:  epoch,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("Error adding Dockerfile to build context: %v", err)
+	}
+	if _, err := tw.Write(dockerfile); err != nil {
+		return fmt.Errorf("Error adding Dockerfile to build context: %v", err)
+	}
+
+	// written maps each entry to the path it was read from
+	written := make(map[string]string)
+	for _, dir := range dirs {
+		if err := addDirectory(tw, root, dir, origins, replace, written); err != nil {
+			return fmt.Errorf("Error adding directory %s to build context: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// addDirectory adds dir, relative to root or its directory in origins, and everything
+// in it that isn't ignored. A file is added by itself. Files with a path in replace
+// are replaced.
+func addDirectory(tw *tar.Writer, root string, dir string, origins map[string]string, replace map[string]File, written map[string]string) error {
+	prefix := path.Clean(filepath.ToSlash(dir))
+	base := filepath.Join(root, dir)
+	for origin, originDir := range origins {
+		if prefix == origin || strings.HasPrefix(prefix, origin+"/") {
+			base = filepath.Join(originDir, filepath.FromSlash(strings.TrimPrefix(prefix, origin)))
+		}
+	}
+	info, err := os.Lstat(base)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return addFile(tw, base, prefix, info, replace, written)
+	}
+	matcher, err := readIgnoreFile(base)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(base, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && matcher.ignored(rel) {
+			if info.IsDir() && !matcher.hasExceptions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return addFile(tw, file, path.Join(prefix, rel), info, replace, written)
+	})
+}
+
+// addFile writes one file, directory or symlink to the archive under name, or the
+// file replacing it. Two files written as the same entry, such as a file and its
+// template, are an error, and a path added twice is only written once.
+func addFile(tw *tar.Writer, file string, name string, info os.FileInfo, replace map[string]File, written map[string]string) error {
+	replacement, replaced := replace[name]
+	if replaced && !info.Mode().IsRegular() {
+		return fmt.Errorf("Can't replace %s, it isn't a regular file", name)
+	}
+	entry := name
+	if replaced {
+		entry = replacement.Name
+	}
+	if source, ok := written[entry]; ok {
+		if source == name {
+			return nil
+		}
+		return fmt.Errorf("%s and %s are both added as %s", source, name, entry)
+	}
+	written[entry] = name
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// the owner and times on the host mean nothing inside the image, and leaving
+	// them out makes the context reproducible, see Build.Hash
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	hdr.ModTime, hdr.AccessTime, hdr.ChangeTime = epoch, time.Time{}, time.Time{}
+	if replaced {
+		hdr.Name, hdr.Size = replacement.Name, int64(len(replacement.Contents))
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if replaced {
+		_, err := tw.Write(replacement.Contents)
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
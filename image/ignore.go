@@ -0,0 +1,153 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFiles are read from a directory added to the build context, the first one found wins
+var ignoreFiles = []string{".godotignore", ".dockerignore"}
+
+// ignorePattern is one line of an ignore file
+type ignorePattern struct {
+	re      *regexp.Regexp
+	exclude bool
+}
+
+// ignoreMatcher decides which paths of a directory are left out of the build
+// context, following .dockerignore rules: patterns use filepath.Match syntax plus
+// `**` for any number of directories, excluding a directory excludes everything in
+// it, later patterns win and `!` re-includes paths. `.git` is always ignored.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// readIgnoreFile reads the ignore file of dir, if it has one
+func readIgnoreFile(dir string) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error opening %s: %v", name, err)
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if err := m.add(sc.Text()); err != nil {
+				return nil, fmt.Errorf("Invalid pattern in %s: %v", name, err)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("Error reading %s: %v", name, err)
+		}
+		break
+	}
+	return m, nil
+}
+
+// add parses a pattern line, blank lines and comments are skipped
+func (m *ignoreMatcher) add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	exclude := true
+	if strings.HasPrefix(line, "!") {
+		exclude = false
+		line = strings.TrimSpace(line[1:])
+	}
+	line = path.Clean(strings.TrimPrefix(filepath.ToSlash(line), "/"))
+	re, err := patternRegexp(line)
+	if err != nil {
+		return err
+	}
+	m.patterns = append(m.patterns, ignorePattern{re: re, exclude: exclude})
+	return nil
+}
+
+// patternRegexp translates a pattern into a regular expression over slash separated paths
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%s: %v", pattern, err)
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "^") {
+				class = "!" + class[1:]
+			}
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// a pattern matching a directory matches everything below it
+	sb.WriteString("(/.*)?$")
+	return regexp.Compile(sb.String())
+}
+
+// ignored reports whether the slash separated path, relative to the directory, is ignored
+func (m *ignoreMatcher) ignored(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".git" {
+			return true
+		}
+	}
+	ignored := false
+	for _, p := range m.patterns {
+		if p.re.MatchString(rel) {
+			ignored = p.exclude
+		}
+	}
+	return ignored
+}
+
+// hasExceptions reports whether any pattern re-includes paths, in which case
+// ignored directories must still be walked
+func (m *ignoreMatcher) hasExceptions() bool {
+	for _, p := range m.patterns {
+		if !p.exclude {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonError is the errorDetail of a Docker JSON message
+type jsonError struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// jsonMessage is one message of the JSON stream the Docker daemon sends while building
+type jsonMessage struct {
+	Stream       string           `json:"stream,omitempty"`
+	Status       string           `json:"status,omitempty"`
+	Progress     string           `json:"progress,omitempty"`
+	ID           string           `json:"id,omitempty"`
+	Error        *jsonError       `json:"errorDetail,omitempty"`
+	ErrorMessage string           `json:"error,omitempty"`
+	Aux          *json.RawMessage `json:"aux,omitempty"`
+}
+
+// buildAux is the aux message carrying the ID of the built image
+type buildAux struct {
+	ID string `json:"ID"`
+}
+
+// BuildError is returned when the Docker daemon reports that a build failed
+type BuildError struct {
+	// Step is the build step that failed, e.g. "Step 5/12 : RUN make"
+	Step    string
+	Message string
+	Code    int
+}
+
+func (e *BuildError) Error() string {
+	if e.Step == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Step, e.Message)
+}
+
+// displayBuildOutput decodes the build's JSON message stream and prints it to out.
+// Status and progress messages with an id get a line per id, which is updated in
+// place when out is a terminal. It returns the ID of the built image, the sha256
+// digest of its configuration, or a *BuildError if the build failed.
+func displayBuildOutput(in io.Reader, out io.Writer, terminal bool) (string, error) {
+	dec := json.NewDecoder(in)
+	var imageID, builtID, step string
+	p := newProgress(out, terminal)
+	for {
+		var msg jsonMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("Error decoding Docker build output: %v", err)
+		}
+
+		if msg.Error != nil || msg.ErrorMessage != "" {
+			buildErr := &BuildError{Step: step, Message: msg.ErrorMessage}
+			if msg.Error != nil {
+				buildErr.Code = msg.Error.Code
+				if msg.Error.Message != "" {
+					buildErr.Message = msg.Error.Message
+				}
+			}
+			return "", buildErr
+		}
+
+		if msg.Aux != nil {
+			var aux buildAux
+			if err := json.Unmarshal(*msg.Aux, &aux); err == nil && aux.ID != "" {
+				imageID = aux.ID
+			}
+		}
+
+		if msg.Stream != "" {
+			p.reset()
+			fmt.Fprint(out, msg.Stream)
+			for _, line := range strings.Split(msg.Stream, "\n") {
+				if strings.HasPrefix(line, "Step ") {
+					step = strings.TrimSpace(line)
+				}
+				if strings.HasPrefix(line, "Successfully built ") {
+					builtID = strings.TrimSpace(strings.TrimPrefix(line, "Successfully built "))
+				}
+			}
+		}
+
+		if msg.Status != "" {
+			if msg.ID == "" {
+				p.reset()
+				fmt.Fprintln(out, msg.Status)
+			} else {
+				p.update(msg.ID, msg.Status, msg.Progress)
+			}
+		}
+	}
+	// daemons older than API 1.30 only report the short ID in the output
+	if imageID == "" {
+		imageID = builtID
+	}
+	if imageID == "" {
+		return "", fmt.Errorf("Docker didn't report the ID of the built image")
+	}
+	return imageID, nil
+}
+
+// progress prints the status and progress of the ids of a run of messages, one
+// line per id
+type progress struct {
+	out      io.Writer
+	terminal bool
+	// ids are the ids with a line, in order, lines their index
+	ids   []string
+	lines map[string]int
+	// status and bar are the last status and progress bar printed for each id
+	status map[string]string
+	bar    map[string]string
+}
+
+func newProgress(out io.Writer, terminal bool) *progress {
+	return &progress{out: out, terminal: terminal, lines: make(map[string]int), status: make(map[string]string), bar: make(map[string]string)}
+}
+
+// update shows the status and progress bar of id. A terminal rewrites the id's
+// line, otherwise a line is only printed when the status changes, not for each
+// progress update.
+func (p *progress) update(id string, status string, bar string) {
+	line := strings.TrimSpace(status + " " + bar)
+	index, ok := p.lines[id]
+	switch {
+	case !ok:
+		p.lines[id] = len(p.ids)
+		p.ids = append(p.ids, id)
+		fmt.Fprintf(p.out, "%s: %s\n", id, line)
+	case !p.terminal:
+		if p.status[id] != status {
+			fmt.Fprintf(p.out, "%s: %s\n", id, line)
+		}
+	case p.status[id] != status || p.bar[id] != bar:
+		up := len(p.ids) - index
+		// move up to the id's line, rewrite it and move back down
+		fmt.Fprintf(p.out, "\x1b[%dA\r\x1b[2K%s: %s\x1b[%dB\r", up, id, line, up)
+	}
+	p.status[id], p.bar[id] = status, bar
+}
+
+// reset starts a new run of lines, after other output was printed below them
+func (p *progress) reset() {
+	p.ids = nil
+	p.lines = make(map[string]int)
+}
@@ -0,0 +1,83 @@
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+package image
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDisplayBuildOutput(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM alpine\n"}
+{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Downloading","progressDetail":{"current":1,"total":2},"progress":"[==>  ]","id":"abc"}
+{"status":"Downloading","progressDetail":{"current":2,"total":2},"progress":"[====>]","id":"abc"}
+{"status":"Pull complete","id":"abc"}
+{"stream":"Step 2/2 : CMD [\"sh\"]\n"}
+{"aux":{"ID":"sha256:0123"}}
+{"stream":"Successfully built 0123\n"}
+`
+	var out bytes.Buffer
+	imageID, err := displayBuildOutput(strings.NewReader(stream), &out, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if imageID != "sha256:0123" {
+		t.Errorf("Unexpected image ID: %s", imageID)
+	}
+	expected := "Step 1/2 : FROM alpine\nlatest: Pulling from library/alpine\nabc: Downloading [==>  ]\nabc: Pull complete\nStep 2/2 : CMD [\"sh\"]\nSuccessfully built 0123\n"
+	if out.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+func TestDisplayBuildOutputError(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM alpine\n"}{"stream":"Step 2/2 : RUN false\n"}` +
+		`{"errorDetail":{"code":1,"message":"The command '/bin/sh -c false' returned a non-zero code: 1"},"error":"The command '/bin/sh -c false' returned a non-zero code: 1"}`
+	var out bytes.Buffer
+	_, err := displayBuildOutput(strings.NewReader(stream), &out, false)
+	buildErr, ok := err.(*BuildError)
+	if !ok {
+		t.Fatalf("Expected a *BuildError, got: %v", err)
+	}
+	if buildErr.Step != "Step 2/2 : RUN false" || buildErr.Code != 1 {
+		t.Errorf("Unexpected build error: %+v", buildErr)
+	}
+
+	if _, err := displayBuildOutput(strings.NewReader("** TEST **"), &out, false); err == nil {
+		t.Errorf("Expected an error decoding invalid output")
+	}
+}
+
+func TestDisplayBuildOutputTerminal(t *testing.T) {
+	stream := `{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Downloading","progress":"[==>  ]","id":"abc"}
+{"status":"Downloading","progress":"[====>]","id":"abc"}
+{"status":"Downloading","progress":"[====>]","id":"abc"}
+{"aux":{"ID":"sha256:0123"}}
+`
+	var out bytes.Buffer
+	if _, err := displayBuildOutput(strings.NewReader(stream), &out, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "latest: Pulling from library/alpine\nabc: Downloading [==>  ]\n\x1b[1A\r\x1b[2Kabc: Downloading [====>]\x1b[1B\r"
+	if out.String() != expected {
+		t.Errorf("Expected output:\n%q\nGot:\n%q", expected, out.String())
+	}
+}
+
+func TestDisplayBuildOutputNoID(t *testing.T) {
+	var out bytes.Buffer
+	imageID, err := displayBuildOutput(strings.NewReader(`{"stream":"Successfully built 0123abcd\n"}`), &out, false)
+	if err != nil || imageID != "0123abcd" {
+		t.Errorf("Expected the ID from the output, got %q (%v)", imageID, err)
+	}
+	if _, err := displayBuildOutput(strings.NewReader(`{"stream":"Step 1/1 : FROM alpine\n"}`), &out, false); err == nil {
+		t.Errorf("Expected an error without an image ID")
+	}
+}
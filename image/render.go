@@ -0,0 +1,94 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteContext writes the build context of b into dir, which must be empty or not
+// exist yet, so it can be built without godot. It holds exactly what would be sent
+// to Docker: the Dockerfile and the files that aren't ignored.
+func (b *Build) WriteContext(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error reading %s: %v", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s isn't empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Error creating %s: %v", dir, err)
+	}
+
+	buildContext := b.Context()
+	defer buildContext.Close()
+	tr := tar.NewReader(buildContext)
+	// directories get their mode once they're filled, in case it isn't writable
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := extract(tr, hdr, dir); err != nil {
+			return fmt.Errorf("Error writing %s: %v", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := filepath.Join(dir, filepath.FromSlash(dirs[i].Name))
+		if err := os.Chmod(name, os.FileMode(dirs[i].Mode).Perm()); err != nil {
+			return fmt.Errorf("Error writing %s: %v", dirs[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// extract writes the archive entry hdr into dir
+func extract(r io.Reader, hdr *tar.Header, dir string) error {
+	name := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+	if rel, err := filepath.Rel(dir, name); err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("Path outside of the context")
+	}
+	mode := os.FileMode(hdr.Mode).Perm()
+	// files inherited from another repository come without their parent directories
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(name, 0755)
+	case tar.TypeSymlink:
+		return os.Symlink(hdr.Linkname, name)
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return fmt.Errorf("Unsupported file type %c", hdr.Typeflag)
+}
@@ -0,0 +1,168 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteContext(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	out := filepath.Join(repoDir, "out")
+	build := &Build{Dockerfile: []byte("FROM alpine"), Root: repoDir, Dirs: []string{"dotfiles"}}
+
+	if err := build.WriteContext(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"Dockerfile":            "FROM alpine",
+		"dotfiles/test.txt":     "bar",
+		"dotfiles/zsh/.zshrc":   "zshrc",
+		"dotfiles/zsh/keep.log": "kept",
+	}
+	for name, contents := range expected {
+		actual, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil || string(actual) != contents {
+			t.Errorf("%s: expected %q, got %q (%v)", name, contents, actual, err)
+		}
+	}
+	for _, name := range []string{"dotfiles/zsh/secret.log", "dotfiles/cache", "dotfiles/.git"} {
+		if _, err := os.Lstat(filepath.Join(out, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be left out", name)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(out, "dotfiles", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("Expected the empty directory to be written: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(out, "dotfiles", "link")); err != nil || target != "zsh/.zshrc" {
+		t.Errorf("Expected the symlink to be written, got %s (%v)", target, err)
+	}
+	if info, err := os.Stat(filepath.Join(out, "dotfiles", "test.txt")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the file mode to be kept: %v", info.Mode())
+	}
+
+	if err := build.WriteContext(out); err == nil {
+		t.Errorf("Expected an error writing into a directory that isn't empty")
+	}
+}
+
+func TestWriteContextReplace(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	out := filepath.Join(repoDir, "out")
+	build := &Build{
+		Dockerfile: []byte("FROM alpine"),
+		Root:       repoDir,
+		Dirs:       []string{"dotfiles"},
+		Replace:    map[string]File{"dotfiles/test.txt": {Name: "dotfiles/rendered.txt", Contents: []byte("rendered")}},
+	}
+
+	if err := build.WriteContext(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(out, "dotfiles", "test.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the replaced file to be left out")
+	}
+	actual, err := ioutil.ReadFile(filepath.Join(out, "dotfiles", "rendered.txt"))
+	if err != nil || string(actual) != "rendered" {
+		t.Errorf("Expected the replacement, got %q (%v)", actual, err)
+	}
+	if info, err := os.Stat(filepath.Join(out, "dotfiles", "rendered.txt")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the replacement to keep the file mode: %v", err)
+	}
+}
+
+func TestWriteContextDuplicate(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "dotfiles", "zsh", ".zshrc.tmpl"), []byte("{{.x}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := &Build{
+		Dockerfile: []byte("FROM alpine"),
+		Root:       repoDir,
+		Dirs:       []string{"dotfiles", "dotfiles/test.txt"},
+		Replace:    map[string]File{"dotfiles/zsh/.zshrc.tmpl": {Name: "dotfiles/zsh/.zshrc", Contents: []byte("rendered")}},
+	}
+
+	err := build.WriteContext(filepath.Join(repoDir, "out"))
+	if err == nil || !strings.Contains(err.Error(), "dotfiles/zsh/.zshrc and dotfiles/zsh/.zshrc.tmpl are both added as dotfiles/zsh/.zshrc") {
+		t.Errorf("Expected a duplicate entry error, got: %v", err)
+	}
+	delete(build.Replace, "dotfiles/zsh/.zshrc.tmpl")
+	if err := os.Remove(filepath.Join(repoDir, "dotfiles", "zsh", ".zshrc.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	if err := build.WriteContext(filepath.Join(repoDir, "out2")); err != nil {
+		t.Errorf("Expected a path added twice to be written once, got: %v", err)
+	}
+}
+
+func TestWriteContextDirectoryModes(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	private := filepath.Join(repoDir, "dotfiles", "private")
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(private, "key"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := filepath.Join(repoDir, "dotfiles", "read-only")
+	if err := os.Mkdir(readOnly, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(readOnly, "file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(readOnly, 0755)
+	out := filepath.Join(repoDir, "out")
+	build := &Build{Dockerfile: []byte("FROM alpine"), Root: repoDir, Dirs: []string{"dotfiles"}}
+
+	if err := build.WriteContext(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Chmod(filepath.Join(out, "dotfiles", "read-only"), 0755)
+	for name, mode := range map[string]os.FileMode{"private": 0700, "read-only": 0555} {
+		info, err := os.Stat(filepath.Join(out, "dotfiles", name))
+		if err != nil || info.Mode().Perm() != mode {
+			t.Errorf("Expected %s to have mode %o: %v", name, mode, err)
+		}
+	}
+}
+
+func TestWriteContextOrigins(t *testing.T) {
+	repoDir := writeDotfiles(t)
+	defer os.RemoveAll(repoDir)
+	baseDir := writeDotfiles(t)
+	defer os.RemoveAll(baseDir)
+	out := filepath.Join(repoDir, "out")
+	build := &Build{
+		Dockerfile: []byte("FROM alpine"),
+		Root:       repoDir,
+		Dirs:       []string{".godot/extends/base/dotfiles/test.txt"},
+		Origins:    map[string]string{".godot/extends/base": baseDir},
+	}
+
+	if err := build.WriteContext(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, ".godot", "extends", "base", "dotfiles", "test.txt")); err != nil {
+		t.Errorf("Expected the file of the other directory: %v", err)
+	}
+}
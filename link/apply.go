@@ -0,0 +1,96 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package link
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// backupSuffix is appended to the names of files moved out of the way by Backup
+const backupSuffix = ".godot-backup"
+
+// Apply creates the links on this machine. Sources are read from the dotfile
+// directory dotfiles, or from rendered when they're made from another file, and ~
+// in targets is home.
+// Links that already point at their source are left alone, other existing files
+// are handled according to policy.
+func Apply(links []Link, dotfiles string, rendered string, home string, policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	for _, l := range links {
+		dir := dotfiles
+		if l.From != "" {
+			dir = rendered
+		}
+		source, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(l.Source)))
+		if err != nil {
+			return fmt.Errorf("Error finding %s: %v", l.Source, err)
+		}
+		target := expandHome(l.Target, home)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("Error creating directory for %s: %v", target, err)
+		}
+		if existing, err := os.Readlink(target); err == nil && existing == source {
+			continue
+		}
+		if _, err := os.Lstat(target); err == nil {
+			switch policy.orDefault() {
+			case Backup:
+				backup, err := backupPath(target)
+				if err != nil {
+					return err
+				}
+				if err := os.Rename(target, backup); err != nil {
+					return fmt.Errorf("Error backing up %s: %v", target, err)
+				}
+				log.Printf("Moved %s to %s", target, backup)
+			case Overwrite:
+				if err := os.RemoveAll(target); err != nil {
+					return fmt.Errorf("Error removing %s: %v", target, err)
+				}
+			case Skip:
+				log.Printf("Skipping %s, it already exists", target)
+				continue
+			case Fail:
+				return fmt.Errorf("%s already exists", target)
+			}
+		}
+		if err := os.Symlink(source, target); err != nil {
+			return fmt.Errorf("Error linking %s: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ in the slash separated target with home
+func expandHome(target string, home string) string {
+	if target == "~" || strings.HasPrefix(target, "~/") {
+		return filepath.Join(home, filepath.FromSlash(strings.TrimPrefix(target[1:], "/")))
+	}
+	return filepath.FromSlash(target)
+}
+
+// backupPath returns the first unused backup name for target
+func backupPath(target string) (string, error) {
+	backup := target + backupSuffix
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			return backup, nil
+		} else if err != nil {
+			return "", fmt.Errorf("Error backing up %s: %v", target, err)
+		}
+		backup = fmt.Sprintf("%s%s.%d", target, backupSuffix, i)
+	}
+}
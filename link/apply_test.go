@@ -0,0 +1,97 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package link
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// checkLink fails the test if target isn't a link to the file written for source
+func checkLink(t *testing.T, source string, target string) {
+	contents, err := ioutil.ReadFile(target)
+	if err != nil || string(contents) != source {
+		t.Errorf("Expected %s to link to %s, got %q (%v)", target, source, contents, err)
+	}
+	if info, err := os.Lstat(target); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to be a link (%v)", target, err)
+	}
+}
+
+// checkFile fails the test if p isn't a regular file holding contents
+func checkFile(t *testing.T, p string, expected string) {
+	info, err := os.Lstat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected %s to be a file (%v)", p, err)
+		return
+	}
+	contents, err := ioutil.ReadFile(p)
+	if err != nil || string(contents) != expected {
+		t.Errorf("Expected %s to hold %q, got %q (%v)", p, expected, contents, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Creating symbolic links needs privileges on Windows")
+	}
+	dotfiles := writeDotfiles(t, "bash/.bashrc", "bash/.profile", "nvim/.config/nvim/init.vim")
+	defer os.RemoveAll(dotfiles)
+	links, err := Plan(dotfiles, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, policy := range []Policy{Backup, Overwrite, Skip, Fail} {
+		home, err := ioutil.TempDir("", "godot-home")
+		if err != nil {
+			t.Fatalf("Error creating temporary directory: %v", err)
+		}
+		defer os.RemoveAll(home)
+		// created by useradd
+		if err := ioutil.WriteFile(filepath.Join(home, ".bashrc"), []byte("default"), 0644); err != nil {
+			t.Fatalf("Error writing .bashrc: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(home, ".bashrc.godot-backup"), []byte("old backup"), 0644); err != nil {
+			t.Fatalf("Error writing backup: %v", err)
+		}
+
+		err = Apply(links, dotfiles, "", home, policy)
+		if policy == Fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", policy, err)
+		}
+		checkLink(t, "bash/.profile", filepath.Join(home, ".profile"))
+		checkLink(t, "nvim/.config/nvim/init.vim", filepath.Join(home, ".config", "nvim", "init.vim"))
+		switch policy {
+		case Backup:
+			checkLink(t, "bash/.bashrc", filepath.Join(home, ".bashrc"))
+			checkFile(t, filepath.Join(home, ".bashrc.godot-backup"), "old backup")
+			checkFile(t, filepath.Join(home, ".bashrc.godot-backup.1"), "default")
+		case Overwrite:
+			checkLink(t, "bash/.bashrc", filepath.Join(home, ".bashrc"))
+		case Skip:
+			checkFile(t, filepath.Join(home, ".bashrc"), "default")
+		}
+
+		// applying again leaves the links alone
+		if err := Apply(links, dotfiles, "", home, Fail); policy != Skip && err != nil {
+			t.Errorf("%s: unexpected error applying again: %v", policy, err)
+		}
+	}
+}
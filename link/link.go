@@ -0,0 +1,222 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+// Package link links dotfiles into a home directory. Every directory at the top of
+// the dotfile directory is a package, and the files in it are linked into the home
+// directory, or the package's target directory, at the same relative path.
+package link
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TemplateSuffix ends the names of dotfiles that are rendered before they're linked
+const TemplateSuffix = ".tmpl"
+
+// Policy is what to do when a link's target already exists
+type Policy string
+
+const (
+	// Backup renames the existing file to <name>.godot-backup
+	Backup Policy = "backup"
+	// Overwrite removes the existing file
+	Overwrite Policy = "overwrite"
+	// Skip leaves the existing file and doesn't create the link
+	Skip Policy = "skip"
+	// Fail stops linking with an error
+	Fail Policy = "fail"
+)
+
+// Validate checks that p is a known policy, the empty policy means Backup
+func (p Policy) Validate() error {
+	switch p {
+	case "", Backup, Overwrite, Skip, Fail:
+		return nil
+	}
+	return fmt.Errorf("Unknown conflict policy %q, use backup, overwrite, skip or fail", string(p))
+}
+
+// UnmarshalYAML reads and validates a policy
+func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if err := Policy(s).Validate(); err != nil {
+		return err
+	}
+	*p = Policy(s)
+	return nil
+}
+
+func (p Policy) orDefault() Policy {
+	if p == "" {
+		return Backup
+	}
+	return p
+}
+
+// Options control how dotfiles are linked
+type Options struct {
+	// Conflict is what to do with existing files, Backup by default
+	Conflict Policy `yaml:"conflict,omitempty"`
+	// Ignore are patterns of files not to link. A pattern matches a file's path in
+	// the dotfile directory, its path in its package or any of its names.
+	Ignore []string `yaml:"ignore,omitempty"`
+	// Targets are the directories packages are linked into by package name, either
+	// absolute or starting with ~. Other packages are linked into ~.
+	Targets map[string]string `yaml:"targets,omitempty"`
+	// Made maps files that are made into another file before they're linked,
+	// besides templates, such as encrypted files, to the name of that file. Both
+	// are relative to the dotfile directory.
+	Made map[string]string `yaml:"-"`
+}
+
+// Validate checks the conflict policy, ignore patterns and targets
+func (o Options) Validate() error {
+	if err := o.Conflict.Validate(); err != nil {
+		return err
+	}
+	for _, pattern := range o.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid ignore pattern %q: %v", pattern, err)
+		}
+	}
+	for pkg, target := range o.Targets {
+		if target != "~" && !strings.HasPrefix(target, "~/") && !path.IsAbs(target) {
+			return fmt.Errorf("Target %s of %s must be absolute or start with ~", target, pkg)
+		}
+	}
+	return nil
+}
+
+// Merge returns o extended by child: child's conflict policy wins, ignore patterns
+// are appended and child's targets override o's
+func (o Options) Merge(child Options) Options {
+	merged := Options{Conflict: o.Conflict, Ignore: append(append([]string(nil), o.Ignore...), child.Ignore...)}
+	if child.Conflict != "" {
+		merged.Conflict = child.Conflict
+	}
+	if len(o.Targets)+len(child.Targets) > 0 {
+		merged.Targets = make(map[string]string)
+		for pkg, target := range o.Targets {
+			merged.Targets[pkg] = target
+		}
+		for pkg, target := range child.Targets {
+			merged.Targets[pkg] = target
+		}
+	}
+	return merged
+}
+
+// ignored reports whether the file at p in the dotfile directory matches a pattern
+func (o Options) ignored(p string) bool {
+	names := strings.Split(p, "/")
+	candidates := append([]string{p}, names...)
+	if len(names) > 1 {
+		candidates = append(candidates, strings.Join(names[1:], "/"))
+	}
+	for _, pattern := range o.Ignore {
+		for _, candidate := range candidates {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Link is a symbolic link to create
+type Link struct {
+	// Source is the path of the file in the dotfile directory, or of the file made
+	// from From
+	Source string
+	// Target is where the link is created, absolute or starting with ~
+	Target string
+	// From is the path of the template or other file in the dotfile directory the
+	// file is made from, if any
+	From string
+}
+
+// Plan lists the links for the dotfile directory root, sorted by target. Files at
+// the top of root aren't in a package and aren't linked. Templates and files with
+// one of the suffixes of opts are linked without their suffix. A missing root has
+// no links. Paths use forward slashes.
+func Plan(root string, opts Options) ([]Link, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading dotfile directory: %v", err)
+	}
+
+	var links []Link
+	for _, entry := range entries {
+		pkg := entry.Name()
+		if !entry.IsDir() || pkg == ".git" || opts.ignored(pkg) {
+			continue
+		}
+		target, ok := opts.Targets[pkg]
+		if !ok {
+			target = "~"
+		}
+		err := filepath.Walk(filepath.Join(root, pkg), func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == pkg {
+				return nil
+			}
+			if opts.ignored(rel) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			l := Link{Source: rel}
+			if made, ok := opts.Made[rel]; ok {
+				l = Link{Source: made, From: rel}
+			} else if strings.HasSuffix(rel, TemplateSuffix) {
+				l = Link{Source: strings.TrimSuffix(rel, TemplateSuffix), From: rel}
+			}
+			l.Target = path.Join(target, strings.TrimPrefix(l.Source, pkg+"/"))
+			links = append(links, l)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error reading package %s: %v", pkg, err)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Target < links[j].Target })
+	for i := 1; i < len(links); i++ {
+		if links[i].Target == links[i-1].Target {
+			return nil, fmt.Errorf("%s and %s are both linked to %s", links[i-1].Source, links[i].Source, links[i].Target)
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,109 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package link
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeDotfiles creates a dotfile directory holding files
+func writeDotfiles(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "godot-dotfiles")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	for _, name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating directory for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestPlan(t *testing.T) {
+	dir := writeDotfiles(t,
+		"README.md",
+		"zsh/.zshrc",
+		"zsh/.zsh/my theme.zsh",
+		"zsh/.zsh/theme.zsh~",
+		"nvim/.config/nvim/init.vim",
+		"bin/tool",
+		"git/.gitconfig.tmpl",
+		"net/.netrc.gpg",
+		"scratch/notes",
+		".git/HEAD",
+	)
+	defer os.RemoveAll(dir)
+
+	links, err := Plan(dir, Options{
+		Ignore:  []string{"*~", "scratch"},
+		Targets: map[string]string{"bin": "~/.local/bin"},
+		Made:    map[string]string{"net/.netrc.gpg": "net/.netrc"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Link{
+		{Source: "nvim/.config/nvim/init.vim", Target: "~/.config/nvim/init.vim"},
+		{Source: "git/.gitconfig", Target: "~/.gitconfig", From: "git/.gitconfig.tmpl"},
+		{Source: "bin/tool", Target: "~/.local/bin/tool"},
+		{Source: "net/.netrc", Target: "~/.netrc", From: "net/.netrc.gpg"},
+		{Source: "zsh/.zsh/my theme.zsh", Target: "~/.zsh/my theme.zsh"},
+		{Source: "zsh/.zshrc", Target: "~/.zshrc"},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, links)
+	}
+
+	if links, err := Plan(filepath.Join(dir, "missing"), Options{}); err != nil || links != nil {
+		t.Errorf("Expected no links for a missing directory, got %+v (%v)", links, err)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	dir := writeDotfiles(t, "bash/.bashrc", "other/.bashrc")
+	defer os.RemoveAll(dir)
+
+	tests := map[string]Options{
+		"duplicate target": {},
+		"bad pattern":      {Ignore: []string{"["}},
+		"relative target":  {Targets: map[string]string{"bash": "bin"}},
+		"unknown policy":   {Conflict: "rename"},
+	}
+	for name, opts := range tests {
+		if _, err := Plan(dir, opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Options{Conflict: Fail, Ignore: []string{"*.md"}, Targets: map[string]string{"bin": "~/bin", "etc": "/etc"}}
+	child := Options{Ignore: []string{"*~"}, Targets: map[string]string{"bin": "~/.local/bin"}}
+	expected := Options{
+		Conflict: Fail,
+		Ignore:   []string{"*.md", "*~"},
+		Targets:  map[string]string{"bin": "~/.local/bin", "etc": "/etc"},
+	}
+	if merged := base.Merge(child); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, merged)
+	}
+	if merged := base.Merge(Options{Conflict: Skip}); merged.Conflict != Skip {
+		t.Errorf("Expected the child's policy, got %s", merged.Conflict)
+	}
+}
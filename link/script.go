@@ -0,0 +1,59 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package link
+
+import (
+	"path"
+	"strings"
+)
+
+// linkFunction creates the link $2 to $1 with the conflict handling of a policy.
+// Sources left out of the build context are skipped.
+const linkFunction = `godot_link() { ` +
+	`[ -e "$1" ] || [ -L "$1" ] || return 0; ` +
+	`mkdir -p "$(dirname "$2")" || return 1; ` +
+	`if [ -L "$2" ] && [ "$(readlink "$2")" = "$1" ]; then return 0; fi; ` +
+	`if [ -e "$2" ] || [ -L "$2" ]; then %s; fi; ` +
+	`ln -s "$1" "$2"; }`
+
+// conflictCommands handle an existing $2 for each policy
+var conflictCommands = map[Policy]string{
+	Backup: `b="$2` + backupSuffix + `"; n=1; ` +
+		`while [ -e "$b" ] || [ -L "$b" ]; do b="$2` + backupSuffix + `.$n"; n=$((n + 1)); done; ` +
+		`mv "$2" "$b" || return 1`,
+	Overwrite: `rm -rf "$2" || return 1`,
+	Skip:      `echo "Skipping $2, it already exists" >&2; return 0`,
+	Fail:      `echo "$2 already exists" >&2; return 1`,
+}
+
+// Script returns shell commands creating the links, to be joined with &&. Sources
+// are read from the dotfile directory dotfiles, which may start with ~ like the
+// targets. There are no commands without links.
+func Script(links []Link, dotfiles string, policy Policy) []string {
+	if len(links) == 0 {
+		return nil
+	}
+	commands := []string{strings.Replace(linkFunction, "%s", conflictCommands[policy.orDefault()], 1)}
+	for _, l := range links {
+		commands = append(commands, "godot_link "+shellQuote(path.Join(dotfiles, l.Source))+" "+shellQuote(l.Target))
+	}
+	return commands
+}
+
+// shellQuote quotes s for the shell, leaving a leading ~ to be expanded
+func shellQuote(s string) string {
+	if s == "~" {
+		return s
+	}
+	if strings.HasPrefix(s, "~/") {
+		return "~/" + shellQuote(s[2:])
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,81 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package link
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	if Script(nil, "~/dotfiles", Backup) != nil {
+		t.Errorf("Expected no commands without links")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("No shell to run the script")
+	}
+
+	home, err := ioutil.TempDir("", "godot-home")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(home)
+	dotfiles := filepath.Join(home, "dotfiles")
+	for _, name := range []string{"bash/.bashrc", "bash/.profile", "nvim/.config/nvim/it's.vim"} {
+		p := filepath.Join(dotfiles, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Error creating directory for %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".bashrc"), []byte("default"), 0644); err != nil {
+		t.Fatalf("Error writing .bashrc: %v", err)
+	}
+	links, err := Plan(dotfiles, Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// left out of the build context
+	links = append(links, Link{Source: "bash/.ignored", Target: "~/.ignored"})
+
+	run := func(policy Policy) error {
+		cmd := exec.Command(sh, "-c", strings.Join(Script(links, "~/dotfiles", policy), " && "))
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Logf("%s", out)
+		}
+		return err
+	}
+	if err := run(Fail); err == nil {
+		t.Errorf("Expected the script to fail on the existing .bashrc")
+	}
+	if err := run(Backup); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkLink(t, "bash/.bashrc", filepath.Join(home, ".bashrc"))
+	checkLink(t, "bash/.profile", filepath.Join(home, ".profile"))
+	checkLink(t, "nvim/.config/nvim/it's.vim", filepath.Join(home, ".config", "nvim", "it's.vim"))
+	checkFile(t, filepath.Join(home, ".bashrc.godot-backup"), "default")
+	if _, err := os.Lstat(filepath.Join(home, ".ignored")); !os.IsNotExist(err) {
+		t.Errorf("Expected no link for a missing source (%v)", err)
+	}
+	// existing links are left alone
+	if err := run(Fail); err != nil {
+		t.Errorf("Unexpected error running again: %v", err)
+	}
+}
@@ -10,16 +10,31 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
+	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/mitchellh/go-homedir"
 	"github.com/pmalmgren/godot/conf"
+	"github.com/pmalmgren/godot/container"
 	"github.com/pmalmgren/godot/image"
+	"github.com/pmalmgren/godot/link"
+	"github.com/pmalmgren/godot/secret"
+	"github.com/pmalmgren/godot/term"
 	"github.com/urfave/cli"
 )
 
@@ -27,96 +42,1363 @@ const (
 	dockerVersion = "1.39"
 )
 
-// builds the docker image, this function does a ton of setup with temporary directories
-func buildDockerimage(gdc *conf.GoDotConfig) error {
-	tmpDir, err := ioutil.TempDir("/tmp/", "godot-build-context")
+// version is godot's version, recorded in the images it builds
+var version = "0.0.1"
+
+// dockerClient initializes the Docker CLI client
+func dockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.WithVersion(dockerVersion))
 	if err != nil {
-		return fmt.Errorf("Error creating temporary directory: %v", err)
+		return nil, fmt.Errorf("Error initializing Docker client: %v", err)
 	}
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			log.Printf("Error removing temporary directory: %v", err)
+	return cli, nil
+}
+
+// buildOptions are the command line options of the commands that build the image
+type buildOptions struct {
+	// Force builds the image even if it is up to date
+	Force bool
+	// MatchHostUser gives the user in the image the UID and GID of the host user
+	MatchHostUser bool
+	// Ref is the branch, tag or commit to build, the default branch if empty
+	Ref string
+}
+
+// newBuild describes the image of gdc, built from the rendered Dockerfile and the
+// dotfile directory of repo with its templates rendered. Secrets are decrypted into
+// the image in the image secrets mode, otherwise they're empty placeholders.
+func newBuild(repo conf.Repository, gdc *conf.GoDotConfig, bo buildOptions) (*image.Build, error) {
+	commit, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		image.SourceLabel:  repo.Source(),
+		image.VersionLabel: version,
+	}
+	if commit != "" {
+		labels[image.RevisionLabel] = commit
+	}
+	rendered, err := gdc.RenderTemplates()
+	if err != nil {
+		return nil, err
+	}
+	replace := make(map[string]image.File, len(rendered))
+	for name, contents := range rendered {
+		replace[name] = image.File{Name: strings.TrimSuffix(name, link.TemplateSuffix), Contents: contents}
+	}
+	secrets, err := gdc.SecretFiles()
+	if err != nil {
+		return nil, err
+	}
+	decrypted := map[string][]byte{}
+	if len(secrets) > 0 && gdc.Secrets.Mode == secret.Image {
+		d, err := secret.NewDecrypter()
+		if err != nil {
+			return nil, err
+		}
+		if decrypted, err = gdc.DecryptSecrets(d); err != nil {
+			return nil, err
 		}
-	}()
-	// gdc.DockerfileRendered contains the contents of conf/dockerfile_template.go
-	dockerfilePath := fmt.Sprintf("%s/Dockerfile", tmpDir)
-	dotfileDirectory := fmt.Sprintf("%s/%s", gdc.RepoDirectory, gdc.DotfileDirectory)
-	err = ioutil.WriteFile(dockerfilePath, []byte(gdc.DockerfileRendered), 0666)
+	}
+	for _, name := range secrets {
+		decryptedName, _ := secret.Name(name)
+		replace[name] = image.File{Name: decryptedName, Contents: decrypted[name]}
+	}
+	build := &image.Build{
+		Dockerfile: []byte(gdc.DockerfileRendered),
+		Root:       gdc.RepoDirectory,
+		Dirs:       gdc.ContextPaths(),
+		Origins:    gdc.Origins,
+		Tag:        gdc.ImageTag,
+		Labels:     labels,
+		Force:      bo.Force,
+		Replace:    replace,
+	}
+	if bo.MatchHostUser {
+		build.BuildArgs = hostUserArgs()
+	}
+	return build, nil
+}
+
+// builds the docker image, streaming the rendered Dockerfile and the dotfile directory as the build context
+func buildDockerimage(cli *client.Client, repo conf.Repository, gdc *conf.GoDotConfig, bo buildOptions) (string, error) {
+	build, err := newBuild(repo, gdc, bo)
+	if err != nil {
+		return "", err
+	}
+	imageID, err := image.BuildImage(cli, build)
+	if err != nil {
+		return "", fmt.Errorf("Error building Docker image: %v", err)
+	}
+	log.Printf("Image %s is %s", gdc.ImageTag, imageID)
+	return imageID, nil
+}
+
+// buildOptionsFromContext reads the options shared by the commands that build the image
+func buildOptionsFromContext(ctx *cli.Context) buildOptions {
+	return buildOptions{MatchHostUser: ctx.Bool("match-host-user"), Ref: ctx.String("ref")}
+}
+
+// loadOptionsFromContext reads the options choosing and completing the configuration
+func loadOptionsFromContext(ctx *cli.Context) (conf.LoadOptions, error) {
+	vars, err := conf.ParseVars(ctx.StringSlice("set"))
+	if err != nil {
+		return conf.LoadOptions{}, err
+	}
+	keys, err := trustedKeys(ctx.Bool("verify-signature"))
 	if err != nil {
-		return fmt.Errorf("Error writing to Docker build context file: %v", err)
+		return conf.LoadOptions{}, err
 	}
-	context, err := image.BuildDockerContext(dockerfilePath, dotfileDirectory)
+	return conf.LoadOptions{ConfigName: ctx.String("config"), Profile: ctx.String("profile"), Vars: vars, TrustedKeys: keys}, nil
+}
+
+// trustedKeys returns the keys cloned repositories must be signed by when verify or
+// the verify-signature setting is set, and no keys otherwise
+func trustedKeys(verify bool) (string, error) {
+	settings, err := conf.LoadSettings()
 	if err != nil {
-		return fmt.Errorf("Error creating Docker build context tarfile: %v", err)
+		return "", err
 	}
-	defer func() {
-		if err := os.RemoveAll(filepath.Dir(context)); err != nil {
-			log.Printf("Error removing temporary build context: %v", err)
+	if !verify && !settings.VerifySignature {
+		return "", nil
+	}
+	return settings.Keyring()
+}
+
+// dockerArch returns the architecture of the Docker daemon, which images are built for
+func dockerArch(cli *client.Client) (string, error) {
+	v, err := cli.ServerVersion(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("Error reading Docker version: %v", err)
+	}
+	return v.Arch, nil
+}
+
+// openRepository opens the dotfiles repository u. A local directory is used as-is,
+// uncommitted changes included, unless a ref is given, and with trustedKeys its
+// HEAD must be signed and its changes committed. Otherwise the repository is
+// cloned into the cache, or the cached clone is updated, and ref, or the default
+// branch if it is empty, is checked out after verifying its signature with
+// trustedKeys if it's set. The caller must call cleanup.
+func openRepository(u *url.URL, ref string, trustedKeys string) (repo conf.Repository, cleanup func(), err error) {
+	if u.Scheme == "" {
+		dir, err := localDirectory(u.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ref == "" {
+			if trustedKeys != "" {
+				if err := conf.VerifyDirectory(dir, trustedKeys); err != nil {
+					return nil, nil, err
+				}
+			}
+			return &conf.FilesystemRepository{RepoDirectory: dir}, func() {}, nil
 		}
-	}()
+		u = &url.URL{Path: dir}
+	}
 
-	// Initialize the Docker CLI client.
-	cli, err := client.NewClientWithOpts(client.WithVersion(dockerVersion))
+	cached, release, err := conf.CachedRepository(u, ref, trustedKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading from Git repository: %v", err)
+	}
+	return cached, release, nil
+}
+
+// releaseOnce returns a function calling cleanup the first time it's called, so a
+// repository can be released early and still be released on every return
+func releaseOnce(cleanup func()) func() {
+	released := false
+	return func() {
+		if !released {
+			released = true
+			cleanup()
+		}
+	}
+}
+
+// localDirectory returns the absolute path of the directory path, expanding ~
+func localDirectory(path string) (string, error) {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return "", fmt.Errorf("Error expanding %s: %v", path, err)
+	}
+	dir, err := filepath.Abs(expanded)
+	if err != nil {
+		return "", fmt.Errorf("Error finding %s: %v", path, err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+	return dir, nil
+}
+
+// hostUserArgs returns the uid and gid build arguments of the user running godot
+func hostUserArgs() map[string]string {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 || gid < 0 {
+		log.Printf("Warning: the host user's IDs are unknown on this platform")
+		return nil
+	}
+	return map[string]string{"uid": strconv.Itoa(uid), "gid": strconv.Itoa(gid)}
+}
+
+// godot builds the docker image
+func godot(u *url.URL, opts conf.LoadOptions, bo buildOptions) error {
+	repo, cleanup, err := openRepository(u, bo.Ref, opts.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	if opts.Arch, err = dockerArch(cli); err != nil {
+		return err
+	}
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	_, err = buildDockerimage(cli, repo, gdc, bo)
+	if err != nil {
+		return fmt.Errorf("Error building Docker Image: %v", err)
+	}
+	return nil
+}
+
+// render writes the build context of the docker image to gdc.OutputDirectory, or
+// streams it as a tar archive to out if tarball is set, without contacting Docker
+func render(u *url.URL, opts conf.LoadOptions, bo buildOptions, out string, tarball bool) error {
+	repo, cleanup, err := openRepository(u, bo.Ref, opts.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	gdc.OutputDirectory = out
+	// stdout can only take an archive
+	if out == "-" {
+		tarball = true
+	}
+	build, err := newBuild(repo, gdc, bo)
+	if err != nil {
+		return err
+	}
+
+	if !tarball {
+		if err := build.WriteContext(gdc.OutputDirectory); err != nil {
+			return fmt.Errorf("Error writing build context: %v", err)
+		}
+		log.Printf("Wrote the build context to %s, build it with: docker build %s-t %s %s", gdc.OutputDirectory, buildArgFlags(build.BuildArgs), gdc.ImageTag, gdc.OutputDirectory)
+		return nil
+	}
+	w := os.Stdout
+	if gdc.OutputDirectory != "-" {
+		f, err := os.Create(gdc.OutputDirectory)
+		if err != nil {
+			return fmt.Errorf("Error creating %s: %v", gdc.OutputDirectory, err)
+		}
+		w = f
+	}
+	buildContext := build.Context()
+	defer buildContext.Close()
+	_, err = io.Copy(w, buildContext)
+	if w != os.Stdout {
+		// the archive is only complete once the file is closed
+		if closeErr := w.Close(); err == nil && closeErr != nil {
+			return fmt.Errorf("Error writing %s: %v", gdc.OutputDirectory, closeErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing build context: %v", err)
+	}
+	return nil
+}
+
+// buildArgFlags formats build arguments as docker build flags
+func buildArgFlags(args map[string]string) string {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	flags := ""
+	for _, name := range names {
+		flags += fmt.Sprintf("--build-arg %s=%s ", name, args[name])
+	}
+	return flags
+}
+
+// run builds the docker image if it is out of date and runs it, mounting the
+// current directory unless co.NoProject is set. It returns the container's exit code.
+func run(u *url.URL, opts conf.LoadOptions, bo buildOptions, co containerOptions) (int, error) {
+	repo, cleanup, err := openRepository(u, bo.Ref, opts.TrustedKeys)
+	if err != nil {
+		return 0, err
+	}
+	release := releaseOnce(cleanup)
+	defer release()
+
+	cli, err := dockerClient()
+	if err != nil {
+		return 0, err
+	}
+	if opts.Arch, err = dockerArch(cli); err != nil {
+		return 0, err
+	}
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return 0, fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	if _, err := buildDockerimage(cli, repo, gdc, bo); err != nil {
+		return 0, fmt.Errorf("Error building Docker Image: %v", err)
+	}
+
+	projectDir, err := co.projectDirectory()
+	if err != nil {
+		return 0, err
+	}
+	config, hostConfig, err := container.Spec(gdc, gdc.ImageTag, projectDir, isTerminal())
 	if err != nil {
-		return fmt.Errorf("Error initializing Docker client: %v", err)
+		return 0, err
+	}
+	if err := co.forward(config, hostConfig); err != nil {
+		return 0, err
+	}
+	if gdc.Secrets.Mode != secret.Image {
+		dir, err := ioutil.TempDir("", "godot-secrets")
+		if err != nil {
+			return 0, fmt.Errorf("Error creating secrets directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := mountSecrets(gdc, dir, hostConfig); err != nil {
+			return 0, err
+		}
 	}
+	// other godot commands wait for the cached clones, so they aren't kept for the
+	// whole session
+	gdc.Close()
+	release()
+	return container.Run(cli, config, hostConfig, standardStreams())
+}
 
-	err = image.BuildDockerImage(cli, context, gdc.ImageTag)
+// mountSecrets decrypts the secrets of gdc into dir and mounts them into the
+// container over their placeholders. Existing files in dir are rewritten in place,
+// so a running container sees the new contents.
+func mountSecrets(gdc *conf.GoDotConfig, dir string, hostConfig *containertypes.HostConfig) error {
+	secrets, err := gdc.SecretFiles()
+	if err != nil || len(secrets) == 0 {
+		return err
+	}
+	d, err := secret.NewDecrypter()
 	if err != nil {
-		return fmt.Errorf("Error building Docker image: %v", err)
+		return err
+	}
+	// only the owner can read them, the user in the container needs the UID running
+	// godot, from --match-host-user or uid
+	if gdc.UID != nil && *gdc.UID != os.Getuid() {
+		log.Printf("Warning: secrets are only readable by UID %d, not the container user's UID %d", os.Getuid(), *gdc.UID)
 	}
+	names, err := gdc.WriteSecrets(d, dir, 0600)
+	if err != nil {
+		return err
+	}
+	hostConfig.Binds = append(hostConfig.Binds, container.SecretBinds(gdc, dir, names)...)
 	return nil
 }
 
-// godot builds and runs the docker image
-func godot(u *url.URL) error {
-	tmpDir, err := ioutil.TempDir("", "/tmp")
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			log.Printf("Error removing temporary Git repo: %v", err)
+// containerOptions are the command line options of the commands that start containers
+type containerOptions struct {
+	// NoProject leaves the current directory out of the container
+	NoProject bool
+	// NoForward doesn't forward the SSH agent and git identity
+	NoForward bool
+	// GitCredentials forwards the host's git credentials read-only
+	GitCredentials bool
+	// Recreate replaces the persistent container even if it's running
+	Recreate bool
+}
+
+func containerOptionsFromContext(ctx *cli.Context) containerOptions {
+	return containerOptions{
+		NoProject:      ctx.Bool("no-project"),
+		NoForward:      ctx.Bool("no-forward"),
+		GitCredentials: ctx.Bool("git-credentials"),
+		Recreate:       ctx.Bool("recreate"),
+	}
+}
+
+// forward adds what is forwarded from the host to a container's configuration
+func (co containerOptions) forward(config *containertypes.Config, hostConfig *containertypes.HostConfig) error {
+	if co.NoForward && !co.GitCredentials {
+		return nil
+	}
+	f, err := container.HostForward(co.GitCredentials)
+	if err != nil {
+		return fmt.Errorf("Error forwarding host credentials: %v", err)
+	}
+	if co.NoForward {
+		f = container.Forward{GitCredentials: f.GitCredentials}
+	}
+	f.Apply(config, hostConfig)
+	return nil
+}
+
+// projectDirectory returns the directory mounted into containers, the current
+// directory unless NoProject is set
+func (co containerOptions) projectDirectory() (string, error) {
+	if co.NoProject {
+		return "", nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("Error finding current directory: %v", err)
+	}
+	return dir, nil
+}
+
+// isTerminal reports whether godot runs in a terminal, so containers get a TTY
+func isTerminal() bool {
+	return term.IsTerminal(os.Stdin.Fd()) && term.IsTerminal(os.Stdout.Fd())
+}
+
+func standardStreams() container.Streams {
+	return container.Streams{In: os.Stdin, Out: os.Stdout, Err: os.Stderr}
+}
+
+// up builds the docker image if it is out of date and makes sure the persistent
+// container of the configuration and profile is running it. It returns the
+// container's ID along with the configuration.
+func up(cli *client.Client, u *url.URL, opts conf.LoadOptions, bo buildOptions, co containerOptions) (string, *conf.GoDotConfig, error) {
+	repo, cleanup, err := openRepository(u, bo.Ref, opts.TrustedKeys)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+
+	if opts.Arch, err = dockerArch(cli); err != nil {
+		return "", nil, err
+	}
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	imageID, err := buildDockerimage(cli, repo, gdc, bo)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error building Docker Image: %v", err)
+	}
+	commit, err := repo.Head()
+	if err != nil {
+		return "", nil, err
+	}
+
+	projectDir, err := co.projectDirectory()
+	if err != nil {
+		return "", nil, err
+	}
+	labels := map[string]string{
+		container.RepositoryLabel: repo.Source(),
+		container.CommitLabel:     commit,
+		container.ConfigLabel:     opts.ConfigName,
+		container.ProfileLabel:    opts.Profile,
+	}
+	config, hostConfig, err := container.UpSpec(gdc, gdc.ImageTag, projectDir, labels)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := co.forward(config, hostConfig); err != nil {
+		return "", nil, err
+	}
+	if gdc.Secrets.Mode != secret.Image {
+		dir, err := conf.SecretsPath(container.Name(gdc))
+		if err != nil {
+			return "", nil, err
 		}
-	}()
+		if err := mountSecrets(gdc, dir, hostConfig); err != nil {
+			return "", nil, err
+		}
+	}
+	id, err := container.Up(cli, container.Name(gdc), imageID, config, hostConfig, co.Recreate)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, gdc, nil
+}
+
+// shell starts the persistent container if needed and runs the entrypoint in it,
+// returning its exit code
+func shell(u *url.URL, opts conf.LoadOptions, bo buildOptions, co containerOptions) (int, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return 0, err
+	}
+	id, gdc, err := up(cli, u, opts, bo, co)
+	if err != nil {
+		return 0, err
+	}
+	return container.Exec(cli, id, strings.Fields(gdc.EntryPoint), isTerminal(), standardStreams())
+}
+
+// down stops and removes the persistent container of a configuration and profile,
+// and the secrets decrypted for it
+func down(u *url.URL, opts conf.LoadOptions, volumes bool) error {
+	repo, cleanup, err := openRepository(u, "", "")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	if err := container.Down(cli, container.Name(gdc), volumes); err != nil {
+		return err
+	}
+	dir, err := conf.SecretsPath(container.Name(gdc))
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("Error removing secrets: %v", err)
+	}
+	return nil
+}
+
+// ps prints the containers managed by godot
+func ps() error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	containers, err := container.List(cli)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tREPOSITORY\tPROFILE\tCOMMIT")
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		commit := c.Labels[container.CommitLabel]
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, c.Status, c.Labels[container.RepositoryLabel], c.Labels[container.ProfileLabel], commit)
+	}
+	return w.Flush()
+}
+
+// cacheList prints the cached clones of repositories
+func cacheList() error {
+	clones, err := conf.CachedClones()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tSIZE\tLAST USED\tDIRECTORY")
+	for _, c := range clones {
+		fmt.Fprintf(w, "%s\t%.1f MB\t%s\t%s\n", c.Remote, float64(c.Size)/(1<<20), c.Used.Format("2006-01-02 15:04"), c.Directory)
+	}
+	return w.Flush()
+}
+
+// cacheClean removes the cached clones of repositories, or every cached clone if
+// repositories is empty
+func cacheClean(repositories []string) error {
+	clones, err := conf.CachedClones()
+	if err != nil {
+		return err
+	}
+	remove := map[string]bool{}
+	for _, repoStr := range repositories {
+		u, err := conf.ParseRemote(repoStr)
+		if err != nil {
+			return fmt.Errorf("Error parsing repository: %v", err)
+		}
+		path, err := conf.CachePath(u)
+		if err != nil {
+			return err
+		}
+		remove[path] = true
+	}
+	for _, c := range clones {
+		if len(remove) > 0 && !remove[c.Directory] {
+			continue
+		}
+		delete(remove, c.Directory)
+		if err := c.Remove(); err != nil {
+			return err
+		}
+		log.Printf("Removed %s", c.Directory)
+	}
+	for path := range remove {
+		log.Printf("Warning: no cached clone in %s", path)
+	}
+	return nil
+}
+
+// applyOptions are the command line options of godot apply
+type applyOptions struct {
+	// DryRun prints what would be done without doing it
+	DryRun bool
+	// Yes applies without asking for confirmation
+	Yes bool
+	// Ref is the branch, tag or commit to apply, the default branch if empty
+	Ref string
+}
+
+// applyRepository opens the dotfiles repository u for godot apply. A local
+// directory is used as-is unless a ref is given, verified like in openRepository,
+// otherwise the repository is
+// cloned into the data directory, since the applied dotfiles link into it, and its
+// signature verified with trustedKeys if it's set.
+func applyRepository(u *url.URL, ref string, trustedKeys string) (conf.Repository, error) {
+	if u.Scheme == "" {
+		dir, err := localDirectory(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		if ref == "" {
+			if trustedKeys != "" {
+				if err := conf.VerifyDirectory(dir, trustedKeys); err != nil {
+					return nil, err
+				}
+			}
+			return &conf.FilesystemRepository{RepoDirectory: dir}, nil
+		}
+		u = &url.URL{Path: dir}
+	}
+	repo, err := conf.AppliedRepository(u, ref, trustedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from Git repository: %v", err)
+	}
+	return repo, nil
+}
+
+// apply installs the packages of a configuration with the host's package manager,
+// runs its user-setup steps and links its dotfiles, with templates rendered and
+// secrets decrypted, into the home directory on this machine, in the order of the
+// image, after showing what it will do and asking for confirmation
+func apply(u *url.URL, opts conf.LoadOptions, ao applyOptions) error {
+	repo, err := applyRepository(u, ao.Ref, opts.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	var pm conf.PackageManager
+	if len(gdc.Packages) > 0 {
+		distro, err := conf.HostDistro()
+		if err != nil {
+			return err
+		}
+		pm = distro.PackageManager
+	}
+	plan, err := gdc.HostPlan(pm)
+	if err != nil {
+		return err
+	}
+	if _, err := gdc.RenderTemplates(); err != nil {
+		return err
+	}
+	dotfiles := gdc.HostPath(gdc.DotfileDirectory)
+	rendered, err := conf.RenderedPath(repo.Source())
+	if err != nil {
+		return err
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return fmt.Errorf("Error finding home directory: %v", err)
+	}
+
+	install := asRoot(plan.Install)
+	if plan.Install != "" {
+		fmt.Printf("Install packages with %s:\n    %s %q\n", pm.Name(), strings.Join(install[:len(install)-1], " "), plan.Install)
+	}
+	if len(plan.Commands) > 0 {
+		fmt.Println("Run user-setup in the home directory:")
+		for _, command := range plan.Commands {
+			fmt.Printf("    %s\n", command)
+		}
+	}
+	if len(plan.Links) > 0 {
+		fmt.Printf("Link dotfiles from %s into %s:\n", dotfiles, home)
+		for _, l := range plan.Links {
+			fmt.Printf("    %s -> %s\n", l.Target, l.Source)
+		}
+	}
+	if len(plan.Skipped) > 0 {
+		fmt.Println("Skip steps that can't run on the host:")
+		for _, skipped := range plan.Skipped {
+			fmt.Printf("    %s\n", skipped)
+		}
+	}
+	if ao.DryRun {
+		return nil
+	}
+	if !ao.Yes {
+		ok, err := confirm("Apply?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("Not applied")
+		}
+	}
+
+	if plan.Install != "" {
+		if err := runCommand(install...); err != nil {
+			return fmt.Errorf("Error installing packages: %v", err)
+		}
+	}
+	if len(plan.Commands) > 0 {
+		if err := runCommand("sh", "-c", plan.Script()); err != nil {
+			return fmt.Errorf("Error running user-setup: %v", err)
+		}
+	}
+	if err := gdc.WriteTemplates(rendered); err != nil {
+		return fmt.Errorf("Error rendering templates: %v", err)
+	}
+	if secrets, err := gdc.SecretFiles(); err != nil {
+		return err
+	} else if len(secrets) > 0 {
+		d, err := secret.NewDecrypter()
+		if err != nil {
+			return err
+		}
+		if _, err := gdc.WriteSecrets(d, rendered, 0600); err != nil {
+			return err
+		}
+	}
+	if err := link.Apply(plan.Links, dotfiles, rendered, home, gdc.Link.Conflict); err != nil {
+		return fmt.Errorf("Error linking dotfiles: %v", err)
+	}
+	log.Printf("Applied %s", repo.Source())
+	return nil
+}
+
+// asRoot returns the command line running the shell command as root, with sudo
+// unless godot already runs as root
+func asRoot(command string) []string {
+	if os.Geteuid() == 0 {
+		return []string{"sh", "-c", command}
+	}
+	return []string{"sudo", "sh", "-c", command}
+}
+
+// runCommand runs a command attached to godot's standard streams
+func runCommand(args ...string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// confirm asks a yes or no question in the terminal, no is the default
+func confirm(question string) (bool, error) {
+	if !isTerminal() {
+		return false, fmt.Errorf("Can't ask for confirmation without a terminal, use --yes")
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("Error reading answer: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// secretsOptions are the options of the secrets commands
+type secretsOptions struct {
+	// Repository is the local repository whose configuration lists the recipients
+	Repository string
+	// ConfigName is the configuration file to use, see conf.FindConfig
+	ConfigName string
+	// Recipients are public key files to encrypt for, besides the configured ones
+	Recipients []string
+}
+
+func secretsOptionsFromContext(ctx *cli.Context) secretsOptions {
+	return secretsOptions{
+		Repository: ctx.String("repository"),
+		ConfigName: ctx.String("config"),
+		Recipients: ctx.StringSlice("recipient"),
+	}
+}
+
+// encryptSecret encrypts plaintext for the recipients of so into the file name,
+// armored if it ends in .asc
+func encryptSecret(so secretsOptions, name string, plaintext []byte, perm os.FileMode) error {
+	dir, err := localDirectory(so.Repository)
+	if err != nil {
+		return err
+	}
+	gdc, err := conf.ConfigFromRepository(&conf.FilesystemRepository{RepoDirectory: dir}, conf.LoadOptions{ConfigName: so.ConfigName})
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	recipients, err := gdc.Recipients(so.Recipients)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := secret.Encrypt(plaintext, recipients, secret.Armored(name))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(name, ciphertext, perm); err != nil {
+		return fmt.Errorf("Error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+// secretsAdd encrypts the file src into the new file dest, which keeps the mode of src
+func secretsAdd(so secretsOptions, src string, dest string) error {
+	if _, ok := secret.Name(dest); !ok {
+		return fmt.Errorf("%s must end in %s", dest, strings.Join(secret.Suffixes, " or "))
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists, change it with godot secrets edit", dest)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", src, err)
+	}
+	plaintext, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", src, err)
+	}
+	if err := encryptSecret(so, dest, plaintext, info.Mode().Perm()); err != nil {
+		return err
+	}
+	log.Printf("Encrypted %s into %s", src, dest)
+	return nil
+}
+
+// secretsEdit decrypts the secret name into a private temporary file, opens it in
+// $VISUAL or $EDITOR and encrypts the result back into name if it changed
+func secretsEdit(so secretsOptions, name string) error {
+	decryptedName, ok := secret.Name(name)
+	if !ok {
+		return fmt.Errorf("%s must end in %s", name, strings.Join(secret.Suffixes, " or "))
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", name, err)
+	}
+	ciphertext, err := ioutil.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", name, err)
+	}
+	d, err := secret.NewDecrypter()
+	if err != nil {
+		return err
+	}
+	plaintext, err := d.Decrypt(ciphertext)
+	if err != nil {
+		return fmt.Errorf("Error decrypting %s: %v", name, err)
+	}
+
+	dir, err := ioutil.TempDir("", "godot-secret")
 	if err != nil {
 		return fmt.Errorf("Error creating temporary directory: %v", err)
 	}
-	repo := conf.Repository{Remote: u, RepoDirectory: tmpDir}
-	if err := repo.Pull(); err != nil {
-		return fmt.Errorf("Error reading from Git repository: %v", err)
+	defer os.RemoveAll(dir)
+	edited := filepath.Join(dir, filepath.Base(decryptedName))
+	if err := ioutil.WriteFile(edited, plaintext, 0600); err != nil {
+		return fmt.Errorf("Error writing %s: %v", edited, err)
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
 	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// the editor may come with arguments
+	if err := runCommand("sh", "-c", editor+` "$1"`, "sh", edited); err != nil {
+		return fmt.Errorf("Error running %s: %v", editor, err)
+	}
+	changed, err := ioutil.ReadFile(edited)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", edited, err)
+	}
+	if bytes.Equal(changed, plaintext) {
+		log.Printf("%s didn't change", name)
+		return nil
+	}
+	if err := encryptSecret(so, name, changed, info.Mode().Perm()); err != nil {
+		return err
+	}
+	log.Printf("Encrypted the changes into %s", name)
+	return nil
+}
 
-	gdc, err := conf.ConfigFromReadme(&repo)
+// lint prints the problems found in a repository's godot configuration
+func lint(u *url.URL, configName string, trustedKeys string, fetch bool) error {
+	repo, cleanup, err := openRepository(u, "", trustedKeys)
 	if err != nil {
-		return fmt.Errorf("Error parsing README.md configuration: %v", err)
+		return err
 	}
+	defer cleanup()
 
-	err = buildDockerimage(gdc)
+	src, err := conf.FindConfig(repo, configName)
 	if err != nil {
-		return fmt.Errorf("Error building Docker Image: %v", err)
+		return err
+	}
+	diagnostics := conf.Lint(repo, src, trustedKeys, fetch)
+	for _, d := range diagnostics {
+		fmt.Println(d)
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("Found %d problems in %s", len(diagnostics), src.Path)
+	}
+	fmt.Printf("%s: no problems found\n", src.Path)
+	return nil
+}
+
+// printConfig prints a repository's godot configuration, either as written or with
+// extends and the profile resolved
+func printConfig(u *url.URL, opts conf.LoadOptions, resolved bool) error {
+	repo, cleanup, err := openRepository(u, "", opts.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if !resolved {
+		src, err := conf.FindConfig(repo, opts.ConfigName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n%s", src.Path, src.Raw)
+		return nil
+	}
+
+	gdc, err := conf.ConfigFromRepository(repo, opts)
+	if err != nil {
+		return fmt.Errorf("Error parsing godot configuration: %v", err)
+	}
+	defer gdc.Close()
+	out, err := gdc.Dump()
+	if err != nil {
+		return err
 	}
+	fmt.Print(out)
 	return nil
 }
 
+// repositoryArg parses the repository URL given as the last command line argument
+func repositoryArg(ctx *cli.Context) (*url.URL, error) {
+	if len(ctx.Args()) == 0 {
+		return nil, fmt.Errorf("Missing repository argument")
+	}
+	repoStr := ctx.Args().Get(len(ctx.Args()) - 1)
+	u, err := conf.ParseRemote(repoStr)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing repository: %v", err)
+	}
+	return u, nil
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "godot"
 	app.Usage = "godot build your-repo"
-	app.Version = "0.0.1"
+	app.Version = version
+	configFlag := cli.StringFlag{
+		Name:  "config, c",
+		Usage: "configuration file to use, relative to the repository root",
+	}
+	profileFlag := cli.StringFlag{
+		Name:  "profile, p",
+		Usage: "profile from the configuration to use",
+	}
+	containerFlags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "no-project",
+			Usage: "don't mount the current directory into the container",
+		},
+		cli.BoolFlag{
+			Name:  "no-forward",
+			Usage: "don't forward the SSH agent and git identity into the container",
+		},
+		cli.BoolFlag{
+			Name:  "git-credentials",
+			Usage: "forward ~/.git-credentials into the container, read-only",
+		},
+	}
+	recreateFlag := cli.BoolFlag{
+		Name:  "recreate",
+		Usage: "replace the persistent container even if it's running, stopping it in other terminals",
+	}
+	matchHostUserFlag := cli.BoolFlag{
+		Name:  "match-host-user",
+		Usage: "give the user in the image the UID and GID of the current user",
+	}
+	setFlag := cli.StringSliceFlag{
+		Name:  "set",
+		Usage: "set the template variable key to value, as key=value",
+	}
+	verifyFlag := cli.BoolFlag{
+		Name:  "verify-signature",
+		Usage: "refuse to use cloned revisions that aren't signed by a trusted key",
+	}
+	refFlag := cli.StringFlag{
+		Name:  "ref",
+		Usage: "branch, tag or full commit SHA to build instead of the default branch",
+	}
+	secretsFlags := []cli.Flag{
+		configFlag,
+		cli.StringFlag{
+			Name:  "repository, r",
+			Value: ".",
+			Usage: "local dotfiles repository whose configuration lists the recipients",
+		},
+		cli.StringSliceFlag{
+			Name:  "recipient",
+			Usage: "public key file to encrypt for, besides the configured recipients",
+		},
+	}
 	app.Commands = []cli.Command{
 		{
 			Name:    "build",
 			Aliases: []string{"b"},
+			Usage:   "build a Docker image from a dotfiles repository",
+			Flags: []cli.Flag{
+				configFlag,
+				profileFlag,
+				matchHostUserFlag,
+				refFlag,
+				setFlag,
+				verifyFlag,
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "build even if an up to date image exists",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts, err := loadOptionsFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				bo := buildOptionsFromContext(ctx)
+				bo.Force = ctx.Bool("force")
+				if err := godot(u, opts, bo); err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "render",
+			Usage: "write the Dockerfile and build context to disk, to build them without godot",
+			Flags: []cli.Flag{
+				configFlag,
+				profileFlag,
+				matchHostUserFlag,
+				refFlag,
+				setFlag,
+				verifyFlag,
+				cli.StringFlag{
+					Name:  "out, o",
+					Usage: "directory to write the build context to, or file with --tar, - for a tar archive on stdout",
+				},
+				cli.BoolFlag{
+					Name:  "tar",
+					Usage: "write the build context as a tar archive",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				if ctx.String("out") == "" {
+					return fmt.Errorf("Missing --out")
+				}
+				opts, err := loadOptionsFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				if err := render(u, opts, buildOptionsFromContext(ctx), ctx.String("out"), ctx.Bool("tar")); err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "run",
+			Usage: "build the Docker image if needed and start a container from it",
+			Flags: append([]cli.Flag{configFlag, profileFlag, matchHostUserFlag, refFlag, setFlag, verifyFlag}, containerFlags...),
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts, err := loadOptionsFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				code, err := run(u, opts, buildOptionsFromContext(ctx), containerOptionsFromContext(ctx))
+				if err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				if code != 0 {
+					return cli.NewExitError("", code)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "up",
+			Usage: "build the Docker image if needed and start a persistent container from it",
+			Flags: append([]cli.Flag{configFlag, profileFlag, matchHostUserFlag, refFlag, setFlag, verifyFlag}, append(containerFlags, recreateFlag)...),
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts, err := loadOptionsFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				docker, err := dockerClient()
+				if err != nil {
+					return err
+				}
+				id, gdc, err := up(docker, u, opts, buildOptionsFromContext(ctx), containerOptionsFromContext(ctx))
+				if err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				log.Printf("Container %s is %s", container.Name(gdc), id)
+				return nil
+			},
+		},
+		{
+			Name:  "shell",
+			Usage: "open a shell in the persistent container, starting it if needed",
+			Flags: append([]cli.Flag{configFlag, profileFlag, matchHostUserFlag, refFlag, setFlag, verifyFlag}, append(containerFlags, recreateFlag)...),
 			Action: func(ctx *cli.Context) error {
-				repoStr := ctx.Args().Get(len(ctx.Args()) - 1)
-				u, err := url.Parse(repoStr)
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts, err := loadOptionsFromContext(ctx)
+				if err != nil {
+					return err
+				}
+				code, err := shell(u, opts, buildOptionsFromContext(ctx), containerOptionsFromContext(ctx))
+				if err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				if code != 0 {
+					return cli.NewExitError("", code)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "down",
+			Usage: "stop and remove the persistent container",
+			Flags: []cli.Flag{
+				configFlag,
+				profileFlag,
+				cli.BoolFlag{
+					Name:  "volumes",
+					Usage: "remove the home directory volume as well",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts := conf.LoadOptions{ConfigName: ctx.String("config"), Profile: ctx.String("profile")}
+				if err := down(u, opts, ctx.Bool("volumes")); err != nil {
+					return fmt.Errorf("Error: %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "apply",
+			Usage: "install the packages and dotfiles of a repository on this machine, without Docker",
+			Flags: []cli.Flag{
+				configFlag,
+				profileFlag,
+				cli.StringFlag{
+					Name:  "ref",
+					Usage: "branch, tag or full commit SHA to apply instead of the default branch",
+				},
+				setFlag,
+				verifyFlag,
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "show what would be done without doing it",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "don't ask for confirmation",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				opts, err := loadOptionsFromContext(ctx)
 				if err != nil {
-					return fmt.Errorf("Error parsing repository: %v", err)
+					return err
 				}
-				if err := godot(u); err != nil {
+				ao := applyOptions{DryRun: ctx.Bool("dry-run"), Yes: ctx.Bool("yes"), Ref: ctx.String("ref")}
+				if err := apply(u, opts, ao); err != nil {
 					return fmt.Errorf("Error: %v", err)
 				}
 				return nil
 			},
 		},
+		{
+			Name:  "ps",
+			Usage: "list the persistent containers managed by godot",
+			Action: func(ctx *cli.Context) error {
+				return ps()
+			},
+		},
+		{
+			Name:  "cache",
+			Usage: "manage the cached clones of repositories",
+			Subcommands: []cli.Command{
+				{
+					Name:  "ls",
+					Usage: "list the cached clones",
+					Action: func(ctx *cli.Context) error {
+						return cacheList()
+					},
+				},
+				{
+					Name:      "clean",
+					Usage:     "remove the cached clones of the given repositories, or all of them",
+					ArgsUsage: "[repository...]",
+					Action: func(ctx *cli.Context) error {
+						return cacheClean(ctx.Args())
+					},
+				},
+			},
+		},
+		{
+			Name:  "secrets",
+			Usage: "encrypt and edit the secrets of a dotfiles repository",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "encrypt a file into a new secret, ending in .gpg, or .asc to armor it",
+					ArgsUsage: "src dest",
+					Flags:     secretsFlags,
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) != 2 {
+							return fmt.Errorf("Expected the file to encrypt and the secret to create")
+						}
+						if err := secretsAdd(secretsOptionsFromContext(ctx), ctx.Args().Get(0), ctx.Args().Get(1)); err != nil {
+							return fmt.Errorf("Error: %v", err)
+						}
+						return nil
+					},
+				},
+				{
+					Name:      "edit",
+					Usage:     "decrypt a secret, edit it with $EDITOR and encrypt it again",
+					ArgsUsage: "secret",
+					Flags:     secretsFlags,
+					Action: func(ctx *cli.Context) error {
+						if len(ctx.Args()) != 1 {
+							return fmt.Errorf("Expected the secret to edit")
+						}
+						if err := secretsEdit(secretsOptionsFromContext(ctx), ctx.Args().First()); err != nil {
+							return fmt.Errorf("Error: %v", err)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "lint",
+			Usage: "check a dotfiles repository's godot configuration",
+			Flags: []cli.Flag{
+				configFlag,
+				verifyFlag,
+				cli.BoolFlag{
+					Name:  "fetch",
+					Usage: "clone or update repositories named in extends instead of only reading cached clones",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				keys, err := trustedKeys(ctx.Bool("verify-signature"))
+				if err != nil {
+					return err
+				}
+				return lint(u, ctx.String("config"), keys, ctx.Bool("fetch"))
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "print a dotfiles repository's godot configuration",
+			Flags: []cli.Flag{
+				configFlag,
+				profileFlag,
+				verifyFlag,
+				cli.BoolFlag{
+					Name:  "resolved",
+					Usage: "print the configuration with extends and the profile merged in",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				u, err := repositoryArg(ctx)
+				if err != nil {
+					return err
+				}
+				keys, err := trustedKeys(ctx.Bool("verify-signature"))
+				if err != nil {
+					return err
+				}
+				opts := conf.LoadOptions{ConfigName: ctx.String("config"), Profile: ctx.String("profile"), TrustedKeys: keys}
+				return printConfig(u, opts, ctx.Bool("resolved"))
+			},
+		},
 	}
 
 	err := app.Run(os.Args)
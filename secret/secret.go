@@ -0,0 +1,266 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+// Package secret encrypts and decrypts dotfiles with OpenPGP. Encrypted dotfiles
+// end in .gpg, or .asc when they're ASCII armored, and are decrypted with a key
+// from a keyring file or by gpg and its agent.
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pmalmgren/godot/term"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// messageType is the armor type of an encrypted message
+const messageType = "PGP MESSAGE"
+
+// Suffixes end the names of encrypted dotfiles
+var Suffixes = []string{".gpg", ".asc"}
+
+// Name returns the name of the decrypted file for an encrypted file's name, and
+// whether the name is one of an encrypted file
+func Name(name string) (string, bool) {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return name, false
+}
+
+// Encrypted reports whether the file name with contents is an encrypted secret:
+// .gpg files, and .asc files holding an armored message rather than a key
+func Encrypted(name string, contents []byte) bool {
+	if _, ok := Name(name); !ok {
+		return false
+	}
+	if !Armored(name) {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN "+messageType+"-----"))
+}
+
+// Armored reports whether the encrypted file name is ASCII armored
+func Armored(name string) bool {
+	return strings.HasSuffix(name, ".asc")
+}
+
+// Mode is where decrypted secrets go
+type Mode string
+
+const (
+	// Runtime decrypts secrets when a container starts and mounts them read-only,
+	// the image only holds empty placeholders
+	Runtime Mode = "runtime"
+	// Image decrypts secrets at build time into the image's layers
+	Image Mode = "image"
+)
+
+// Validate checks that m is a known mode, the empty mode means Runtime
+func (m Mode) Validate() error {
+	switch m {
+	case "", Runtime, Image:
+		return nil
+	}
+	return fmt.Errorf("Unknown secrets mode %q, use runtime or image", string(m))
+}
+
+// UnmarshalYAML reads and validates a mode
+func (m *Mode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if err := Mode(s).Validate(); err != nil {
+		return err
+	}
+	*m = Mode(s)
+	return nil
+}
+
+// Options configure the secrets of a dotfile directory
+type Options struct {
+	// Mode is where decrypted secrets go, Runtime by default
+	Mode Mode `yaml:"mode,omitempty"`
+	// Recipients are the public key files in the repository new secrets are
+	// encrypted for
+	Recipients []string `yaml:"recipients,omitempty"`
+}
+
+// Merge returns o extended by child: child's mode wins, and child's recipients
+// replace o's, since they're files in the child's repository
+func (o Options) Merge(child Options) Options {
+	merged := o
+	if child.Mode != "" {
+		merged.Mode = child.Mode
+	}
+	if len(child.Recipients) > 0 {
+		merged.Recipients = child.Recipients
+	}
+	return merged
+}
+
+// Decrypter decrypts secrets
+type Decrypter interface {
+	// Decrypt returns the plaintext of an encrypted file's contents, armored or not
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// NewDecrypter returns a Decrypter using the secret keys of the keyring file named
+// by GODOT_KEYRING, as exported by gpg --export-secret-keys, or gpg and its agent
+// when it isn't set
+func NewDecrypter() (Decrypter, error) {
+	path := os.Getenv("GODOT_KEYRING")
+	if path == "" {
+		return gpg{}, nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading keyring: %v", err)
+	}
+	keys, err := ReadKeys(contents)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading keyring %s: %v", path, err)
+	}
+	return &Keyring{Keys: keys, Passphrase: askPassphrase}, nil
+}
+
+// ReadKeys reads OpenPGP keys, armored or not
+func ReadKeys(contents []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(contents))
+}
+
+// askPassphrase asks for the passphrase of an encrypted secret key
+func askPassphrase(key openpgp.Key) ([]byte, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("Key %s is encrypted and there's no terminal to ask for its passphrase", key.PublicKey.KeyIdString())
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key %s: ", key.PublicKey.KeyIdString())
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// Keyring decrypts secrets with its secret keys
+type Keyring struct {
+	Keys openpgp.EntityList
+	// Passphrase returns the passphrase of an encrypted key, keys stay decrypted
+	// once it's known
+	Passphrase func(key openpgp.Key) ([]byte, error)
+}
+
+// Decrypt decrypts ciphertext with the keyring's keys
+func (k *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	r, err := dearmor(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if symmetric || k.Passphrase == nil {
+			return nil, fmt.Errorf("No key to decrypt with")
+		}
+		for _, key := range keys {
+			passphrase, err := k.Passphrase(key)
+			if err != nil {
+				return nil, err
+			}
+			if err := key.PrivateKey.Decrypt(passphrase); err == nil {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("Wrong passphrase")
+	}
+	md, err := openpgp.ReadMessage(r, k.Keys, prompt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting: %v", err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting: %v", err)
+	}
+	return plaintext, nil
+}
+
+// dearmor returns a reader of the binary message in ciphertext
+func dearmor(ciphertext []byte) (*bytes.Reader, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte("-----BEGIN")) {
+		return bytes.NewReader(ciphertext), nil
+	}
+	block, err := armor.Decode(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading armored message: %v", err)
+	}
+	if block.Type != messageType {
+		return nil, fmt.Errorf("Expected a %s, got a %s", messageType, block.Type)
+	}
+	message, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading armored message: %v", err)
+	}
+	return bytes.NewReader(message), nil
+}
+
+// gpg decrypts secrets with the gpg command, which uses its agent for keys
+type gpg struct{}
+
+func (gpg) Decrypt(ciphertext []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", "--quiet", "--decrypt")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(ciphertext), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error running gpg --decrypt, set GODOT_KEYRING to use a keyring file instead: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Encrypt encrypts plaintext for recipients, ASCII armored if armored is set
+func Encrypt(plaintext []byte, recipients openpgp.EntityList, armored bool) ([]byte, error) {
+	var out bytes.Buffer
+	var w io.WriteCloser = nopCloser{&out}
+	if armored {
+		aw, err := armor.Encode(&out, messageType, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting: %v", err)
+		}
+		w = aw
+	}
+	pw, err := openpgp.Encrypt(w, recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting: %v", err)
+	}
+	if _, err := pw.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("Error encrypting: %v", err)
+	}
+	if err := pw.Close(); err != nil {
+		return nil, fmt.Errorf("Error encrypting: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Error encrypting: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// nopCloser is a writer with a Close that does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
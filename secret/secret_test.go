@@ -0,0 +1,120 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+package secret
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// newKey generates a small key, it only has to be quick. Like gpg's keys it
+// prefers SHA-256, without a preference openpgp wants RIPEMD-160.
+func newKey(t *testing.T, name string) *openpgp.Entity {
+	key, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	return key
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name      string
+		decrypted string
+		encrypted bool
+	}{
+		{"net/.netrc.gpg", "net/.netrc", true},
+		{"ssh/.ssh/id_ed25519.asc", "ssh/.ssh/id_ed25519", true},
+		{"zsh/.zshrc", "zsh/.zshrc", false},
+	}
+	for _, test := range tests {
+		decrypted, encrypted := Name(test.name)
+		if decrypted != test.decrypted || encrypted != test.encrypted {
+			t.Errorf("%s: expected %s %v, got %s %v", test.name, test.decrypted, test.encrypted, decrypted, encrypted)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		encrypted bool
+	}{
+		{".netrc.gpg", "\x85\x01", true},
+		{"id_rsa.asc", "\n-----BEGIN PGP MESSAGE-----\n", true},
+		{"me.asc", "-----BEGIN PGP PUBLIC KEY BLOCK-----\n", false},
+		{".zshrc", "-----BEGIN PGP MESSAGE-----\n", false},
+	}
+	for _, test := range tests {
+		if encrypted := Encrypted(test.name, []byte(test.contents)); encrypted != test.encrypted {
+			t.Errorf("%s: expected %v, got %v", test.name, test.encrypted, encrypted)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := newKey(t, "me")
+	var private bytes.Buffer
+	if err := key.SerializePrivate(&private, nil); err != nil {
+		t.Fatalf("Error exporting key: %v", err)
+	}
+	keys, err := ReadKeys(private.Bytes())
+	if err != nil {
+		t.Fatalf("Error reading keys: %v", err)
+	}
+	keyring := &Keyring{Keys: keys}
+
+	plaintext := []byte("machine example.com password hunter2\n")
+	for _, armored := range []bool{false, true} {
+		ciphertext, err := Encrypt(plaintext, openpgp.EntityList{key}, armored)
+		if err != nil {
+			t.Fatalf("Error encrypting: %v", err)
+		}
+		if isArmored := bytes.HasPrefix(ciphertext, []byte("-----BEGIN PGP MESSAGE-----")); isArmored != armored {
+			t.Errorf("Expected armored to be %v, got %q", armored, ciphertext)
+		}
+		decrypted, err := keyring.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatalf("Error decrypting: %v", err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Expected %q, got %q", plaintext, decrypted)
+		}
+	}
+
+	other := &Keyring{Keys: openpgp.EntityList{newKey(t, "other")}}
+	ciphertext, err := Encrypt(plaintext, openpgp.EntityList{key}, true)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+	if _, err := other.Decrypt(ciphertext); err == nil {
+		t.Errorf("Expected an error decrypting without the recipient's key")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var opts Options
+	if err := yaml.Unmarshal([]byte("mode: image\nrecipients: [keys/me.asc]\n"), &opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("mode: layers\n"), &Options{}); err == nil {
+		t.Errorf("Expected an error for an unknown mode")
+	}
+	merged := opts.Merge(Options{Recipients: []string{"keys/work.asc"}})
+	if merged.Mode != Image || len(merged.Recipients) != 1 || merged.Recipients[0] != "keys/work.asc" {
+		t.Errorf("Expected the image mode and the child's recipients, got %+v", merged)
+	}
+}
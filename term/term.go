@@ -0,0 +1,12 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+// Package term controls the terminal godot runs in: raw mode for containers,
+// window sizes and reading passwords without echo.
+package term
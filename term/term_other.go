@@ -0,0 +1,42 @@
+//
+// godot
+// https://github.com/pmalmgren/godot
+//
+// Copyright © 2018 Peter Malmgren <me@petermalmgren.com>
+// Distributed under the MIT License.
+// See README.md for details.
+//
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package term
+
+import (
+	"fmt"
+	"os"
+)
+
+// IsTerminal reports whether fd is a terminal. Terminals can't be controlled on
+// this platform, so it is always false and the other functions fail.
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+// MakeRaw fails, raw mode isn't supported on this platform
+func MakeRaw(fd uintptr) (func(), error) {
+	return nil, fmt.Errorf("Raw terminals aren't supported on this platform")
+}
+
+// ReadPassword fails, echo can't be turned off on this platform
+func ReadPassword(fd uintptr) ([]byte, error) {
+	return nil, fmt.Errorf("Reading passwords isn't supported on this platform")
+}
+
+// Size fails, terminal sizes aren't supported on this platform
+func Size(fd uintptr) (int, int, error) {
+	return 0, 0, fmt.Errorf("Terminal sizes aren't supported on this platform")
+}
+
+// NotifyResize does nothing, there are no resize signals on this platform
+func NotifyResize(c chan<- os.Signal) {}